@@ -5,6 +5,7 @@ pushd .
 cd src/app
 # XXX: This is stupid.
 cp -r ../localize/data/ .
-gcloud --project sbb-status-4f4eb app deploy --quiet
+cp ../fares/data/fares.json data/
+gcloud --project sbb-status-4f4eb app deploy --quiet app.yaml cron.yaml
 popd
 
@@ -0,0 +1,267 @@
+// Package alerts watches the journeys users subscribed to, and notifies them
+// when their train is delayed, cancelled or leaves from another platform.
+//
+// A Checker makes one pass over all subscriptions. On App Engine it's run by
+// cron; cmd/sbb-server runs it every so often with Run.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"localize"
+	"query"
+	"users"
+)
+
+type Kind int
+
+const (
+	Delayed Kind = iota
+	Cancelled
+	PlatformChanged
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Delayed:
+		return "delayed"
+	case Cancelled:
+		return "cancelled"
+	case PlatformChanged:
+		return "platform_changed"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+type Alert struct {
+	UserID       string
+	Subscription users.Subscription
+	Kind         Kind
+	Departure    localize.Departure
+	// Message is the alert in the subscription's language.
+	Message string
+}
+
+// A Notifier delivers alerts to users.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+const (
+	// DefaultLookahead is how long before departure to start watching.
+	DefaultLookahead = 30 * time.Minute
+	// DefaultMinDelay is the delay in minutes worth an alert, for
+	// subscriptions which don't say.
+	DefaultMinDelay = 3
+	// watchAfter is how long after the scheduled departure to keep
+	// watching, for delays.
+	watchAfter = 30 * time.Minute
+)
+
+type Checker struct {
+	Users users.Store
+	// Departures looks up the departures for p, e.g. with
+	// query.Departures.
+	Departures func(ctx context.Context, p query.Params) ([]localize.Departure, error)
+	Notifier   Notifier
+	// Timezone is the timezone subscriptions' times are in.
+	Timezone  *time.Location
+	Lookahead time.Duration
+	MinDelay  int
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Check looks up every subscribed journey departing soon, and notifies its
+// user of anything they haven't been told yet. It carries on past errors
+// with single journeys, and returns them all.
+func (c *Checker) Check(ctx context.Context) error {
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	t := now().In(c.Timezone)
+	errs := []string{}
+	err := c.Users.Each(ctx, func(id string, u users.User) error {
+		changed := []users.Subscription{}
+		for i := range u.Subscriptions {
+			sent, err := c.check(ctx, id, &u.Subscriptions[i], t)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%v %v: %v", id, u.Subscriptions[i].Departs, err))
+			}
+			if sent {
+				changed = append(changed, u.Subscriptions[i])
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		// The user may have changed since Each read them, e.g. saved a
+		// place or unsubscribed, so only what we learnt is written back.
+		return c.Users.Update(ctx, id, func(u *users.User) error {
+			for _, sub := range changed {
+				for i := range u.Subscriptions {
+					if u.Subscriptions[i].Same(sub) {
+						u.Subscriptions[i].Platform = sub.Platform
+						u.Subscriptions[i].Notified = sub.Notified
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// check checks one subscription, and returns whether it sent anything or
+// otherwise changed sub.
+func (c *Checker) check(ctx context.Context, userID string, sub *users.Subscription, now time.Time) (bool, error) {
+	dep, ok := sub.Scheduled(now)
+	lookahead := c.Lookahead
+	if lookahead <= 0 {
+		lookahead = DefaultLookahead
+	}
+	if !ok || now.Before(dep.Add(-lookahead)) || now.After(dep.Add(watchAfter)) {
+		return false, nil
+	}
+	p := query.Params{
+		Source:      sub.Source,
+		Destination: sub.Destination,
+		Datetime:    dep,
+		Limit:       10,
+	}
+	if sub.Route != "" {
+		p.Route = []string{sub.Route}
+	}
+	deps, err := c.Departures(ctx, p)
+	if err != nil {
+		return false, err
+	}
+	var d *localize.Departure
+	for i := range deps {
+		if deps[i].Departing.Equal(dep) {
+			d = &deps[i]
+			break
+		}
+	}
+	if d == nil || (!d.Cancelled && now.After(d.Departing.Add(time.Duration(d.MinutesDelay)*time.Minute))) {
+		// Not found, or already gone.
+		return false, nil
+	}
+	learnt := false
+	if d.PlatformChanged {
+		d.ScheduledPlatform = sub.Platform
+	} else if d.Platform != "" && d.Platform != sub.Platform {
+		sub.Platform = d.Platform
+		learnt = true
+	}
+
+	day := dep.Format("2006-01-02")
+	notified := []string{}
+	for _, n := range sub.Notified {
+		// Forget the alerts from other days.
+		if strings.HasPrefix(n, day+" ") {
+			notified = append(notified, n)
+		}
+	}
+	sent := learnt || len(notified) != len(sub.Notified)
+	sub.Notified = notified
+	loc := localize.NewLocalizer(sub.Lang, c.Timezone)
+	for _, a := range c.alerts(*sub, *d) {
+		key := day + " " + a.key
+		if contains(sub.Notified, key) {
+			continue
+		}
+		err := c.Notifier.Notify(ctx, Alert{
+			UserID:       userID,
+			Subscription: *sub,
+			Kind:         a.kind,
+			Departure:    *d,
+			Message:      message(loc, a.kind, *d),
+		})
+		if err != nil {
+			return sent, err
+		}
+		sub.Notified = append(sub.Notified, key)
+		sent = true
+	}
+	return sent, nil
+}
+
+type pending struct {
+	kind Kind
+	// key identifies the alert within a day, so it's only sent once.
+	key string
+}
+
+// alerts returns what's worth telling about d.
+func (c *Checker) alerts(sub users.Subscription, d localize.Departure) []pending {
+	if d.Cancelled {
+		return []pending{{Cancelled, "cancelled"}}
+	}
+	as := []pending{}
+	if d.PlatformChanged {
+		as = append(as, pending{PlatformChanged, "platform " + d.Platform})
+	}
+	min := sub.MinDelay
+	if min <= 0 {
+		min = c.MinDelay
+	}
+	if min <= 0 {
+		min = DefaultMinDelay
+	}
+	if d.MinutesDelay >= min {
+		// Tell again each time it's another min minutes later.
+		as = append(as, pending{Delayed, fmt.Sprintf("delayed %d", d.MinutesDelay/min*min)})
+	}
+	return as
+}
+
+func message(loc localize.Localizer, k Kind, d localize.Departure) string {
+	switch k {
+	case Cancelled:
+		return loc.AlertCancelled(d)
+	case PlatformChanged:
+		return loc.AlertPlatformChanged(d)
+	}
+	return loc.AlertDelayed(d)
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+// Run calls c.Check every interval until ctx is done. Errors are passed to
+// logf.
+func Run(ctx context.Context, c *Checker, interval time.Duration, logf func(format string, args ...interface{})) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Check(ctx); err != nil {
+				logf("Error checking alerts: %v", err)
+			}
+		}
+	}
+}
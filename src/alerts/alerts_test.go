@@ -0,0 +1,205 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"localize"
+	"query"
+	"users"
+)
+
+func init() {
+	if err := localize.LoadTranslations("../localize/data"); err != nil {
+		panic(err)
+	}
+}
+
+type fixture struct {
+	checker  *Checker
+	recorder *Recorder
+	now      time.Time
+	dep      localize.Departure
+	queries  int
+}
+
+func newFixture(t *testing.T, sub users.Subscription) *fixture {
+	tz, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := users.NewMemory()
+	u := users.User{}
+	u.Subscribe(sub)
+	if err := store.Put(context.Background(), "u1", u); err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{
+		recorder: &Recorder{},
+		// A Monday.
+		now: time.Date(2018, time.March, 5, 7, 30, 0, 0, tz),
+		dep: localize.Departure{
+			Name:      "S12",
+			From:      "Winterthur",
+			To:        "Zürich HB",
+			Departing: time.Date(2018, time.March, 5, 7, 42, 0, 0, tz),
+			Mode:      "train",
+			Platform:  "3",
+		},
+	}
+	f.checker = &Checker{
+		Users: store,
+		Departures: func(_ context.Context, p query.Params) ([]localize.Departure, error) {
+			f.queries++
+			if p.Source != "Winterthur" || len(p.Route) != 1 || p.Route[0] != "S12" {
+				t.Errorf("unexpected query %+v", p)
+			}
+			return []localize.Departure{f.dep}, nil
+		},
+		Notifier: f.recorder,
+		Timezone: tz,
+		Now:      func() time.Time { return f.now },
+	}
+	return f
+}
+
+func (f *fixture) check(t *testing.T) []Alert {
+	if err := f.checker.Check(context.Background()); err != nil {
+		t.Fatalf("want nil, got '%v'", err)
+	}
+	return f.recorder.Alerts()
+}
+
+var s12 = users.Subscription{
+	Source:  "Winterthur",
+	Route:   "S12",
+	Departs: "07:42",
+	Days:    []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	Lang:    "en",
+}
+
+func TestDelay(t *testing.T) {
+	f := newFixture(t, s12)
+	if as := f.check(t); len(as) != 0 {
+		t.Errorf("want no alerts when on time, got %v", as)
+	}
+
+	f.dep.MinutesDelay = 4
+	as := f.check(t)
+	if len(as) != 1 || as[0].Kind != Delayed || as[0].UserID != "u1" {
+		t.Fatalf("want one delay alert, got %v", as)
+	}
+	if want := "The S12 at 07:42 from Winterthur to Zürich HB is 4 minutes late."; as[0].Message != want {
+		t.Errorf("want '%v', got '%v'", want, as[0].Message)
+	}
+
+	// Nothing new to say.
+	f.dep.MinutesDelay = 5
+	if as := f.check(t); len(as) != 1 {
+		t.Errorf("want no more alerts, got %v", as)
+	}
+	// But it's getting worse.
+	f.dep.MinutesDelay = 7
+	if as := f.check(t); len(as) != 2 {
+		t.Errorf("want another alert, got %v", as)
+	}
+}
+
+func TestCancelledAndPlatform(t *testing.T) {
+	f := newFixture(t, s12)
+	f.dep.Platform, f.dep.PlatformChanged = "4", true
+	as := f.check(t)
+	if len(as) != 1 || as[0].Kind != PlatformChanged {
+		t.Fatalf("want a platform alert, got %v", as)
+	}
+	if want := "The S12 at 07:42 from Winterthur to Zürich HB leaves from platform 4 today."; as[0].Message != want {
+		t.Errorf("want '%v', got '%v'", want, as[0].Message)
+	}
+	f.dep.Cancelled = true
+	as = f.check(t)
+	if len(as) != 2 || as[1].Kind != Cancelled {
+		t.Errorf("want a cancellation alert, got %v", as)
+	}
+}
+
+func TestPlatformInstead(t *testing.T) {
+	f := newFixture(t, s12)
+	// It's seen leaving from platform 3 one day...
+	if as := f.check(t); len(as) != 0 {
+		t.Fatalf("want no alerts, got %v", as)
+	}
+	// ...and from 4 the next.
+	f.now, f.dep.Departing = f.now.AddDate(0, 0, 1), f.dep.Departing.AddDate(0, 0, 1)
+	f.dep.Platform, f.dep.PlatformChanged = "4", true
+	as := f.check(t)
+	if len(as) != 1 || as[0].Kind != PlatformChanged {
+		t.Fatalf("want a platform alert, got %v", as)
+	}
+	if want := "The S12 at 07:42 from Winterthur to Zürich HB leaves from platform 4 instead of 3 today."; as[0].Message != want {
+		t.Errorf("want '%v', got '%v'", want, as[0].Message)
+	}
+}
+
+func TestOutsideWindow(t *testing.T) {
+	f := newFixture(t, s12)
+	f.dep.MinutesDelay = 10
+	for _, now := range []time.Time{
+		f.now.Add(-1 * time.Hour),
+		f.now.Add(2 * time.Hour),
+		// A Saturday.
+		f.now.AddDate(0, 0, 5),
+	} {
+		f.now = now
+		f.check(t)
+	}
+	if f.queries != 0 || len(f.recorder.Alerts()) != 0 {
+		t.Errorf("want no queries or alerts, got %v and %v", f.queries, f.recorder.Alerts())
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	f := newFixture(t, s12)
+	f.dep.MinutesDelay = 10
+	f.recorder.Err = errors.New("unreachable")
+	if err := f.checker.Check(context.Background()); err == nil {
+		t.Error("want error, got nil")
+	}
+	// It's tried again next time.
+	f.recorder.Err = nil
+	if as := f.check(t); len(as) != 1 {
+		t.Errorf("want one alert, got %v", as)
+	}
+}
+
+func TestConcurrentChange(t *testing.T) {
+	f := newFixture(t, s12)
+	f.dep.MinutesDelay = 10
+	ctx := context.Background()
+	departures := f.checker.Departures
+	f.checker.Departures = func(ctx context.Context, p query.Params) ([]localize.Departure, error) {
+		// The user saves a place while the journey's being checked.
+		err := f.checker.Users.Update(ctx, "u1", func(u *users.User) error {
+			u.SavePlace(users.Home, "Stadelhofen")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return departures(ctx, p)
+	}
+	if as := f.check(t); len(as) != 1 {
+		t.Fatalf("want a delay alert, got %v", as)
+	}
+	u, err := f.checker.Users.Get(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Place(users.Home) != "Stadelhofen" {
+		t.Errorf("want the saved place kept, got %v", u.Places)
+	}
+	if len(u.Subscriptions) != 1 || len(u.Subscriptions[0].Notified) != 1 {
+		t.Errorf("want the alert remembered, got %+v", u.Subscriptions)
+	}
+}
@@ -0,0 +1,140 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ActionsPush sends alerts as Actions on Google push notifications. The
+// user must have granted the UPDATE permission for Intent, and Alert.UserID
+// must be the ID they granted it with.
+type ActionsPush struct {
+	// Client must be authorized for the
+	// https://www.googleapis.com/auth/actions.fulfillment.conversation
+	// scope, e.g. with a service account.
+	Client func(ctx context.Context) *http.Client
+	// Intent is triggered when the user taps the notification.
+	Intent string
+	// Endpoint defaults to the Actions API.
+	Endpoint string
+}
+
+func (p ActionsPush) Notify(ctx context.Context, a Alert) error {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://actions.googleapis.com/v2/conversations:send"
+	}
+	msg := map[string]interface{}{
+		"customPushMessage": map[string]interface{}{
+			"userNotification": map[string]string{"title": a.Message},
+			"target": map[string]string{
+				"userId": a.UserID,
+				"intent": p.Intent,
+				"locale": a.Subscription.Lang,
+			},
+		},
+	}
+	return postJSON(p.Client(ctx), endpoint, msg)
+}
+
+// Webhook posts alerts as JSON to URL.
+type Webhook struct {
+	URL    string
+	Client func(ctx context.Context) *http.Client
+}
+
+type webhookDeparture struct {
+	Line      string    `json:"line"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Departing time.Time `json:"departing"`
+	Delay     int       `json:"delay"`
+	Platform  string    `json:"platform,omitempty"`
+	Cancelled bool      `json:"cancelled,omitempty"`
+}
+
+type webhookAlert struct {
+	UserID    string           `json:"user_id"`
+	Kind      Kind             `json:"kind"`
+	Message   string           `json:"message"`
+	Departure webhookDeparture `json:"departure"`
+}
+
+func (w Webhook) Notify(ctx context.Context, a Alert) error {
+	return postJSON(w.Client(ctx), w.URL, webhookAlert{
+		UserID:  a.UserID,
+		Kind:    a.Kind,
+		Message: a.Message,
+		Departure: webhookDeparture{
+			Line:      a.Departure.Name,
+			From:      a.Departure.From,
+			To:        a.Departure.To,
+			Departing: a.Departure.Departing,
+			Delay:     a.Departure.MinutesDelay,
+			Platform:  a.Departure.Platform,
+			Cancelled: a.Departure.Cancelled,
+		},
+	})
+}
+
+func postJSON(client *http.Client, url string, v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Mail is a stand-in for email until we have a way to send it: it writes
+// each alert to W as the mail it would send.
+type Mail struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+func (m *Mail) Notify(_ context.Context, a Alert) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.W, "To: %s\nSubject: %s %s\n\n%s\n\n", a.UserID, a.Departure.Name, a.Kind, a.Message)
+	return err
+}
+
+// Recorder is a fake Notifier for tests and local runs, which keeps the
+// alerts it's given.
+type Recorder struct {
+	mu     sync.Mutex
+	alerts []Alert
+	// Err is returned from Notify, if set. The alert isn't recorded.
+	Err error
+}
+
+func (r *Recorder) Notify(_ context.Context, a Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return r.Err
+	}
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+// Alerts returns the alerts recorded so far.
+func (r *Recorder) Alerts() []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Alert{}, r.alerts...)
+}
@@ -0,0 +1,365 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"localize"
+	"modes"
+	"query"
+)
+
+// The JSON API is described in static/openapi.yaml. Keep the two in sync.
+
+type apiDeparture struct {
+	Line         string     `json:"line"`
+	Mode         modes.Mode `json:"mode"`
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	Departure    time.Time  `json:"departure"`
+	DelayMinutes int        `json:"delay_minutes"`
+	Platform     string     `json:"platform,omitempty"`
+	// PlatformChanged is set if Platform isn't the scheduled one.
+	PlatformChanged bool `json:"platform_changed,omitempty"`
+	// Disruptions are the headers of its service messages.
+	Disruptions []string `json:"disruptions,omitempty"`
+	// TripID is for /api/v1/trip.
+	TripID string `json:"trip_id,omitempty"`
+	// StepFree is set if the provider says it's wheelchair accessible.
+	StepFree bool `json:"step_free,omitempty"`
+	// Occupancy1st and Occupancy2nd are from 1 (low) to 3 (high), if
+	// there's a forecast.
+	Occupancy1st localize.Occupancy `json:"occupancy_1st,omitempty"`
+	Occupancy2nd localize.Occupancy `json:"occupancy_2nd,omitempty"`
+}
+
+type apiDeparturesResponse struct {
+	Station    string         `json:"station"`
+	Departures []apiDeparture `json:"departures"`
+}
+
+type apiConnection struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Departure time.Time      `json:"departure"`
+	Arrival   time.Time      `json:"arrival"`
+	Legs      []apiDeparture `json:"legs"`
+	// Price is nil if neither the provider nor the zone tables know it.
+	Price *apiFare `json:"price,omitempty"`
+}
+
+type apiFare struct {
+	Full    float64 `json:"full"`
+	Half    float64 `json:"half"`
+	Network string  `json:"network,omitempty"`
+	Zones   int     `json:"zones,omitempty"`
+}
+
+type apiConnectionsResponse struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Connections []apiConnection `json:"connections"`
+}
+
+type apiStop struct {
+	Name string `json:"name"`
+	// Arrival and Departure are scheduled; nil at the first and last stop
+	// respectively.
+	Arrival      *time.Time `json:"arrival,omitempty"`
+	Departure    *time.Time `json:"departure,omitempty"`
+	DelayMinutes int        `json:"delay_minutes"`
+	Platform     string     `json:"platform,omitempty"`
+}
+
+type apiTripResponse struct {
+	apiDeparture
+	Stops []apiStop `json:"stops"`
+}
+
+type apiStation struct {
+	Name     string  `json:"name"`
+	Distance float64 `json:"distance"`
+}
+
+type apiStationsResponse struct {
+	Stations []apiStation `json:"stations"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func newAPIDeparture(d localize.Departure) apiDeparture {
+	a := apiDeparture{
+		Line:            d.Name,
+		Mode:            d.Mode,
+		From:            d.From,
+		To:              d.To,
+		Departure:       d.Departing,
+		DelayMinutes:    d.MinutesDelay,
+		Platform:        d.Platform,
+		PlatformChanged: d.PlatformChanged,
+		TripID:          d.TripID,
+		StepFree:        d.StepFree,
+		Occupancy1st:    d.Occupancy1st,
+		Occupancy2nd:    d.Occupancy2nd,
+	}
+	for _, x := range d.Disruptions {
+		a.Disruptions = append(a.Disruptions, x.Header)
+	}
+	return a
+}
+
+func (s *server) writeJSON(writer http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		s.errorf(req, "Error marshalling response: %v", err)
+		http.Error(writer, "Error marshalling response", http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+	if _, err := writer.Write(bs); err != nil {
+		s.errorf(req, "Error writing response: %v", err)
+	}
+}
+
+func (s *server) writeAPIError(writer http.ResponseWriter, req *http.Request, status int, f string, xs ...interface{}) {
+	if status >= 500 {
+		s.errorf(req, f, xs...)
+	}
+	s.writeJSON(writer, req, status, apiError{fmt.Sprintf(f, xs...)})
+}
+
+// list returns a list parameter given either as repeated or comma-separated
+// values, e.g. "modes=tram&modes=bus" or "modes=tram,bus".
+func list(q url.Values, key string) []string {
+	r := []string{}
+	for _, v := range q[key] {
+		for _, x := range strings.Split(v, ",") {
+			if x = strings.TrimSpace(x); x != "" {
+				r = append(r, x)
+			}
+		}
+	}
+	return r
+}
+
+// apiParams parses the query parameters shared by the departures and
+// connections endpoints.
+func (s *server) apiParams(q url.Values) (query.Params, error) {
+	p := query.Params{
+		Transport: list(q, "modes"),
+		Route:     list(q, "routes"),
+		Via:       q.Get("via"),
+		Limit:     s.cfg.Limits.Departures,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			return p, fmt.Errorf("Invalid limit %q", v)
+		}
+		p.Limit = s.limit(l, s.cfg.Limits.Departures)
+	}
+	if v := q.Get("step_free"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("Invalid step_free %q", v)
+		}
+		p.StepFree = b
+	}
+	if v := q.Get("least_crowded"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("Invalid least_crowded %q", v)
+		}
+		p.LeastCrowded = b
+	}
+	if v := q.Get("time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return p, fmt.Errorf("Invalid time %q: must be RFC 3339", v)
+		}
+		p.Datetime = t.In(s.tz)
+	}
+	return p, nil
+}
+
+// apiCoordinates parses the "lat" and "lon" parameters. ok is false if they
+// are absent.
+func apiCoordinates(q url.Values) (lat, lon float64, ok bool, err error) {
+	if q.Get("lat") == "" && q.Get("lon") == "" {
+		return 0, 0, false, nil
+	}
+	if lat, err = strconv.ParseFloat(q.Get("lat"), 64); err != nil {
+		return 0, 0, false, fmt.Errorf("Invalid lat %q", q.Get("lat"))
+	}
+	if lon, err = strconv.ParseFloat(q.Get("lon"), 64); err != nil {
+		return 0, 0, false, fmt.Errorf("Invalid lon %q", q.Get("lon"))
+	}
+	return lat, lon, true, nil
+}
+
+func (s *server) apiDepartures(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		s.writeAPIError(writer, req, http.StatusMethodNotAllowed, "Method %s not allowed", req.Method)
+		return
+	}
+	q := req.URL.Query()
+	p, err := s.apiParams(q)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "%v", err)
+		return
+	}
+	p.Source = s.station(q.Get("station"))
+	lat, lon, ok, err := apiCoordinates(q)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if p.Source == "" && !ok {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "Either station or lat and lon are required")
+		return
+	}
+	p.Lat, p.Lon = lat, lon
+
+	svc, cancel := s.newTransport(s.env.Context(req))
+	defer cancel()
+	if p.Source, err = query.Source(svc, p); err != nil {
+		s.writeAPIError(writer, req, http.StatusBadGateway, "%v", err)
+		return
+	}
+	resp := apiDeparturesResponse{Station: p.Source, Departures: []apiDeparture{}}
+	if p.Source == "" {
+		s.writeJSON(writer, req, http.StatusOK, resp)
+		return
+	}
+	deps, err := query.Stationboard(svc, p, s.tz)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadGateway, "%v", err)
+		return
+	}
+	for _, d := range deps {
+		resp.Departures = append(resp.Departures, newAPIDeparture(d))
+	}
+	s.writeJSON(writer, req, http.StatusOK, resp)
+}
+
+func (s *server) apiConnections(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		s.writeAPIError(writer, req, http.StatusMethodNotAllowed, "Method %s not allowed", req.Method)
+		return
+	}
+	q := req.URL.Query()
+	p, err := s.apiParams(q)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "%v", err)
+		return
+	}
+	p.Source = s.station(q.Get("from"))
+	p.Destination = s.station(q.Get("to"))
+	if p.Source == "" || p.Destination == "" {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "Both from and to are required")
+		return
+	}
+
+	svc, cancel := s.newTransport(s.env.Context(req))
+	defer cancel()
+	conns, err := query.Connections(svc, p, s.tz)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadGateway, "%v", err)
+		return
+	}
+	resp := apiConnectionsResponse{From: p.Source, To: p.Destination, Connections: []apiConnection{}}
+	for _, c := range conns {
+		ac := apiConnection{From: c.From, To: c.To, Departure: c.Departing, Arrival: c.Arriving}
+		for _, l := range c.Legs {
+			ac.Legs = append(ac.Legs, newAPIDeparture(l))
+		}
+		if f := query.Price(c, s.env.Fares); f != nil {
+			ac.Price = &apiFare{Full: f.Full, Half: f.Half, Network: f.Network, Zones: f.Zones}
+		}
+		resp.Connections = append(resp.Connections, ac)
+	}
+	s.writeJSON(writer, req, http.StatusOK, resp)
+}
+
+func (s *server) apiTrip(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		s.writeAPIError(writer, req, http.StatusMethodNotAllowed, "Method %s not allowed", req.Method)
+		return
+	}
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	svc, cancel := s.newTransport(s.env.Context(req))
+	defer cancel()
+	d, err := query.Trip(svc, id, s.tz)
+	if err == query.ErrNoTrip {
+		s.writeAPIError(writer, req, http.StatusNotFound, "%v", err)
+		return
+	} else if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadGateway, "%v", err)
+		return
+	}
+	resp := apiTripResponse{apiDeparture: newAPIDeparture(d), Stops: []apiStop{}}
+	for _, st := range query.AllStops(d) {
+		a := apiStop{Name: st.Name, DelayMinutes: st.MinutesDelay, Platform: st.Platform}
+		if arr := st.Arriving; !arr.IsZero() {
+			a.Arrival = &arr
+		}
+		if dep := st.Departing; !dep.IsZero() {
+			a.Departure = &dep
+		}
+		resp.Stops = append(resp.Stops, a)
+	}
+	s.writeJSON(writer, req, http.StatusOK, resp)
+}
+
+func (s *server) apiNearbyStations(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		s.writeAPIError(writer, req, http.StatusMethodNotAllowed, "Method %s not allowed", req.Method)
+		return
+	}
+	q := req.URL.Query()
+	lat, lon, ok, err := apiCoordinates(q)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if !ok {
+		s.writeAPIError(writer, req, http.StatusBadRequest, "Both lat and lon are required")
+		return
+	}
+	limit := s.cfg.Limits.Stations
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			s.writeAPIError(writer, req, http.StatusBadRequest, "Invalid limit %q", v)
+			return
+		}
+		limit = s.limit(limit, s.cfg.Limits.Stations)
+	}
+
+	svc, cancel := s.newTransport(s.env.Context(req))
+	defer cancel()
+	stats, err := query.Stations(svc, query.Params{Lat: lat, Lon: lon, IgnoredIconClasses: s.cfg.IgnoredIconClasses}, limit)
+	if err != nil {
+		s.writeAPIError(writer, req, http.StatusBadGateway, "%v", err)
+		return
+	}
+	resp := apiStationsResponse{Stations: []apiStation{}}
+	for _, s := range stats {
+		resp.Stations = append(resp.Stations, apiStation{Name: s.Name, Distance: s.Distance})
+	}
+	s.writeJSON(writer, req, http.StatusOK, resp)
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"config"
+)
+
+// fakeTimetable serves departures from Stadelhofen, a connection to Uster
+// and nearby stations, like search.ch, and the connection's trip, like
+// opendata.ch. Connections to "Nowhere" fail.
+func fakeTimetable(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stationboard.json", func(w http.ResponseWriter, r *http.Request) {
+		deps := []string{}
+		for i := 0; i < 30; i++ {
+			deps = append(deps, fmt.Sprintf(`{"time": "2018-03-05 12:%02d:00", "type": "strain", "line": "S%d", "terminal": {"name": "Uster"}, "track": "3"}`, i, i))
+		}
+		fmt.Fprintf(w, `{"stop": {"name": "Stadelhofen"}, "connections": [%v]}`, strings.Join(deps, ","))
+	})
+	mux.HandleFunc("/route.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("to") == "Nowhere" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"connections": [{"from": "Stadelhofen", "to": "Uster", "departure": "2018-03-05 12:04:00", "arrival": "2018-03-05 12:19:00",
+		  "legs": [{"departure": "2018-03-05 12:04:00", "tripid": "T1", "sbb_name": "Stadelhofen", "type": "strain", "line": "S5", "exit": {"sbb_name": "Uster", "arrival": "2018-03-05 12:19:00"}}]}]}`)
+	})
+	mux.HandleFunc("/completion.json", func(w http.ResponseWriter, r *http.Request) {
+		if term := r.URL.Query().Get("term"); term != "" {
+			fmt.Fprintf(w, `[{"label": %q, "iconclass": "sl-icon-type-train"}]`, term)
+			return
+		}
+		fmt.Fprint(w, `[{"label": "Stadelhofen", "dist": 120, "iconclass": "sl-icon-type-train"}, {"label": "Kreuzplatz", "dist": 400, "iconclass": "sl-icon-type-tram"}]`)
+	})
+	mux.HandleFunc("/journey", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "T1" {
+			http.Error(w, `{"errors": [{"message": "Journey not found"}]}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"category": "S", "number": "5", "to": "Uster", "passList": [
+		  {"station": {"name": "Zürich HB"}, "departureTimestamp": 1520247660, "platform": "41/42"},
+		  {"station": {"name": "Stadelhofen"}, "arrivalTimestamp": 1520247780, "departureTimestamp": 1520247840, "platform": "3"},
+		  {"station": {"name": "Uster"}, "arrivalTimestamp": 1520248740, "platform": "1"}]}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+// apiConfig is the default configuration, using upstream as the timetable
+// API.
+func apiConfig(upstream *httptest.Server) config.Config {
+	cfg := config.Default()
+	cfg.Endpoints = config.Endpoints{
+		Stationboard: upstream.URL + "/stationboard.json",
+		Connections:  upstream.URL + "/route.json",
+		Locations:    upstream.URL + "/completion.json",
+		Trip:         upstream.URL + "/journey",
+	}
+	cfg.Fares = ""
+	return cfg
+}
+
+func newAPIHandler(t *testing.T, upstream *httptest.Server) http.Handler {
+	cfg := apiConfig(upstream)
+	h, err := NewHandler(Env{Config: &cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestAPIErrors(t *testing.T) {
+	upstream := fakeTimetable(t)
+	defer upstream.Close()
+	h := newAPIHandler(t, upstream)
+
+	for _, tc := range []struct {
+		method, url string
+		status      int
+		err         string
+	}{
+		{"POST", "/api/v1/departures?station=Stadelhofen", http.StatusMethodNotAllowed, "Method POST not allowed"},
+		{"GET", "/api/v1/departures", http.StatusBadRequest, "Either station or lat and lon are required"},
+		{"GET", "/api/v1/departures?station=Stadelhofen&limit=many", http.StatusBadRequest, `Invalid limit "many"`},
+		{"GET", "/api/v1/departures?station=Stadelhofen&limit=0", http.StatusBadRequest, `Invalid limit "0"`},
+		{"GET", "/api/v1/departures?station=Stadelhofen&step_free=maybe", http.StatusBadRequest, `Invalid step_free "maybe"`},
+		{"GET", "/api/v1/departures?station=Stadelhofen&time=noon", http.StatusBadRequest, `Invalid time "noon": must be RFC 3339`},
+		{"GET", "/api/v1/departures?lat=north&lon=8.5", http.StatusBadRequest, `Invalid lat "north"`},
+		{"GET", "/api/v1/departures?lat=47.4", http.StatusBadRequest, `Invalid lon ""`},
+		{"GET", "/api/v1/connections?from=Stadelhofen", http.StatusBadRequest, "Both from and to are required"},
+		{"GET", "/api/v1/connections?from=Stadelhofen&to=Nowhere", http.StatusBadGateway, ""},
+		{"GET", "/api/v1/stations/nearby?lat=47.4", http.StatusBadRequest, `Invalid lon ""`},
+		{"GET", "/api/v1/stations/nearby", http.StatusBadRequest, "Both lat and lon are required"},
+		{"GET", "/api/v1/stations/nearby?lat=47.4&lon=8.5&limit=-1", http.StatusBadRequest, `Invalid limit "-1"`},
+		{"GET", "/api/v1/trip", http.StatusBadRequest, "id is required"},
+		{"GET", "/api/v1/trip?id=T2", http.StatusNotFound, "no such trip"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, nil))
+		if w.Code != tc.status {
+			t.Errorf("%v %v: want %v, got %v: %v", tc.method, tc.url, tc.status, w.Code, w.Body)
+			continue
+		}
+		var resp apiError
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Error == "" {
+			t.Errorf("%v %v: want a JSON error, got %v", tc.method, tc.url, err)
+		} else if tc.err != "" && resp.Error != tc.err {
+			t.Errorf("%v %v: want error %q, got %q", tc.method, tc.url, tc.err, resp.Error)
+		}
+	}
+}
+
+func TestAPIResponses(t *testing.T) {
+	upstream := fakeTimetable(t)
+	defer upstream.Close()
+	h := newAPIHandler(t, upstream)
+	get := func(url string, v interface{}) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%v: want 200, got %v: %v", url, w.Code, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%v: want JSON, got %q", url, ct)
+		}
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("%v: %v", url, err)
+		}
+	}
+
+	var deps apiDeparturesResponse
+	get("/api/v1/departures?station=Stadelhofen&limit=2", &deps)
+	if deps.Station != "Stadelhofen" || len(deps.Departures) != 2 {
+		t.Fatalf("want 2 departures from Stadelhofen, got %+v", deps)
+	}
+	if d := deps.Departures[0]; d.Line != "S0" || d.Mode != "train" || d.To != "Uster" || d.Platform != "3" || d.Departure.IsZero() {
+		t.Errorf("want the S0 to Uster from platform 3, got %+v", d)
+	}
+	// Asking for more than the maximum gets the maximum.
+	get("/api/v1/departures?station=Stadelhofen&limit=1000", &deps)
+	if want := config.Default().Limits.Max; len(deps.Departures) != want {
+		t.Errorf("want %v departures, got %v", want, len(deps.Departures))
+	}
+	get("/api/v1/departures?lat=47.36&lon=8.55&limit=1", &deps)
+	if deps.Station != "Stadelhofen" || len(deps.Departures) != 1 {
+		t.Errorf("want a departure from the nearest station, got %+v", deps)
+	}
+
+	var conns apiConnectionsResponse
+	get("/api/v1/connections?from=Stadelhofen&to=Uster", &conns)
+	if len(conns.Connections) != 1 || len(conns.Connections[0].Legs) != 1 || conns.Connections[0].Legs[0].Line != "S5" {
+		t.Fatalf("want the S5 to Uster, got %+v", conns)
+	}
+
+	var trip apiTripResponse
+	get("/api/v1/trip?id="+conns.Connections[0].Legs[0].TripID, &trip)
+	if trip.Line != "S5" || len(trip.Stops) != 3 || trip.Stops[0].Name != "Zürich HB" || trip.Stops[2].Arrival == nil {
+		t.Errorf("want every stop of the S5 from Zürich HB, got %+v", trip)
+	}
+
+	var stations apiStationsResponse
+	get("/api/v1/stations/nearby?lat=47.36&lon=8.55&limit=1", &stations)
+	if len(stations.Stations) != 1 || stations.Stations[0].Name != "Stadelhofen" || stations.Stations[0].Distance != 120 {
+		t.Errorf("want Stadelhofen 120m away, got %+v", stations)
+	}
+}
+
+func TestAPIIgnoredIconClasses(t *testing.T) {
+	upstream := fakeTimetable(t)
+	defer upstream.Close()
+	// Each handler keeps to its own configuration.
+	h := newAPIHandler(t, upstream)
+	cfg := apiConfig(upstream)
+	cfg.IgnoredIconClasses = []string{"sl-icon-type-tram"}
+	noTrams, err := NewHandler(Env{Config: &cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		h    http.Handler
+		want int
+	}{{h, 2}, {noTrams, 1}, {h, 2}} {
+		w := httptest.NewRecorder()
+		tc.h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stations/nearby?lat=47.36&lon=8.55&limit=5", nil))
+		var resp apiStationsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Stations) != tc.want {
+			t.Errorf("want %v stations, got %+v", tc.want, resp.Stations)
+		}
+	}
+}
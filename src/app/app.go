@@ -6,58 +6,87 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/urlfetch"
-
+	"config"
 	"localize"
+	"query"
 	"transport"
+	"when"
 )
 
-var (
-	timezone *time.Location
-)
-
-func init() {
-	var err error
-	timezone, err = time.LoadLocation("Europe/Zurich")
+// datetime resolves the date-time parameter. until is set if the user asked
+// for a window; see resolveDate and isWindow. If it can't be resolved, ok is
+// false and dresp asks again.
+func (s *server) datetime(dreq DialogflowRequest, loc localize.Localizer, dresp *DialogflowResponse) (t, until time.Time, ok bool) {
+	raw := dreq.Result.Parameters.DateTime
+	t, until, err := resolveDate(raw, s.tz, time.Now())
 	if err != nil {
-		panic(err)
+		dresp.Speech = loc.UnknownTime(string(raw))
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		return time.Time{}, time.Time{}, false
 	}
-	http.HandleFunc("/dialogflow", dialogflow)
+	if !isWindow(raw, dreq.Result.Parameters.Window) {
+		until = time.Time{}
+	}
+	return t, until, true
 }
 
-// Returns zero time if failure.
-func tryParseStupidDate(raw string) time.Time {
-	var result time.Time
-	var err error
-	if result, err = time.ParseInLocation("15:04:05", raw, timezone); err != nil {
-		if result, err = time.ParseInLocation("2006-01-02T15:04:05Z", raw, timezone); err != nil {
-			result = time.Time{}
+// isWindow returns whether the user asked for everything in the period raw,
+// rather than just when to start: they said so, as in "all departures
+// tomorrow morning" (window is "all"), or gave both ends, as in "between
+// 17:00 and 18:00". Paging through a window takes many requests, which
+// "the next train tomorrow morning" doesn't need.
+func isWindow(raw when.Value, window string) bool {
+	if window != "" {
+		return true
+	}
+	parts := strings.Split(string(raw), "/")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, x := range parts {
+		if _, err := time.Parse("15:04:05", x); err != nil {
+			return false
 		}
-	} else {
-		// Successfully parsed as HH:MM:SS, so we assume it's today.
-		// XXX: This will be dumb around midnight, I guess. Remember to email the Dialogflow folks about how this is silly.
-		now := time.Now()
-		result = time.Date(now.Year(), now.Month(), now.Day(), result.Hour(), result.Minute(), result.Second(), 0, timezone)
 	}
-	return result
+	return true
 }
 
-func mode(category string) string {
-	if r, ok := map[string]string{
-		"strain":        "train",
-		"express_train": "train",
-		"walk":          "walk",
-		"tram":          "tram"}[category]; ok {
-		return r
-	}
-	// XXX: ????
-	return category
+// resolveDate returns when to look for departures from for raw, which
+// Dialogflow gives us as a date, a time, a date-time or a period, or as the
+// user's own words if it couldn't make sense of them. It returns the zero
+// time, meaning now, if raw is empty. For periods up to query.MaxWindow,
+// like "between 17:00 and 18:00" or "this afternoon", until is when the
+// period ends.
+func resolveDate(raw when.Value, tz *time.Location, now time.Time) (t, until time.Time, err error) {
+	r := when.Resolver{Location: tz, Now: func() time.Time { return now }}
+	rng, err := r.Resolve(string(raw))
+	if err != nil || rng.IsZero() {
+		return time.Time{}, time.Time{}, err
+	}
+	if rng.End.After(rng.Start) && rng.End.Sub(rng.Start) <= query.MaxWindow {
+		until = rng.End
+	}
+	return rng.From(now.In(tz)), until, nil
+}
+
+func hasLocation(dreq DialogflowRequest) bool {
+	return dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude != 0.0 &&
+		dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude != 0.0
+}
+
+// requestLocation asks for permission to use the device's location. The
+// intent asked again with the location is "<intent>-with-permission".
+func requestLocation(loc localize.Localizer, dresp *DialogflowResponse) {
+	dresp.Speech = loc.NeedLocation()
+	dresp.Data = &DialogflowResponse_Data{Google: &DialogflowResponse_Data_Google{
+		SystemIntent: &DialogflowResponse_Data_Google_SystemIntent{Intent: "actions.intent.PERMISSION"}}}
+	dresp.Data.Google.SystemIntent.Data.Type = "type.googleapis.com/google.actions.v2.PermissionValueSpec"
+	dresp.Data.Google.SystemIntent.Data.OptContext = loc.PermissionContext()
+	dresp.Data.Google.SystemIntent.Data.Permissions = []string{"DEVICE_PRECISE_LOCATION"}
 }
 
 func prettyName(category, number string) string {
@@ -70,9 +99,9 @@ func prettyName(category, number string) string {
 	return fmt.Sprintf("%s%s", category, number)
 }
 
-func dialogflow(writer http.ResponseWriter, req *http.Request) {
+func (s *server) dialogflow(writer http.ResponseWriter, req *http.Request) {
 	handleError := func(f string, xs ...interface{}) {
-		log.Errorf(appengine.NewContext(req), f, xs...)
+		s.errorf(req, f, xs...)
 		http.Error(writer, fmt.Sprintf(f, xs...), http.StatusInternalServerError)
 	}
 	// Parse request body into DialogflowRequest
@@ -82,19 +111,17 @@ func dialogflow(writer http.ResponseWriter, req *http.Request) {
 		handleError("Error reading POST: %v", err)
 		return
 	}
-	log.Infof(appengine.NewContext(req), "RAW:\n %v", string(bs))
+	s.infof(req, "RAW:\n %v", string(bs))
 	if err := json.Unmarshal(bs, &dreq); err != nil {
 		handleError("Error unmarshalling POST: %v", err)
 		return
 	}
 	dresp := DialogflowResponse{}
-	ctx, _ := context.WithTimeout(appengine.NewContext(req), 1*time.Minute)
-	svc := transport.Transport{
-		Client: urlfetch.Client(ctx),
-		Logger: func(x string) { log.Infof(appengine.NewContext(req), "%s", x) },
-	}
+	ctx := s.env.Context(req)
+	svc, cancel := s.newTransport(ctx)
+	defer cancel()
 
-	log.Infof(appengine.NewContext(req), "Received intent %v", dreq.Result.Metadata.IntentName)
+	s.infof(req, "Received intent %v", dreq.Result.Metadata.IntentName)
 	switch dreq.Result.Metadata.IntentName {
 	case "next-departure":
 		fallthrough
@@ -103,11 +130,71 @@ func dialogflow(writer http.ResponseWriter, req *http.Request) {
 	case "from-here-to":
 		fallthrough
 	case "from-here-to-with-permission":
-		err = stationboard(svc, dreq, &dresp)
+		fallthrough
+	case "departures-more":
+		fallthrough
+	case "departures-mode-only":
+		fallthrough
+	case "return-trip":
+		fallthrough
+	case "to-place":
+		fallthrough
+	case "to-place-with-permission":
+		err = s.stationboard(ctx, svc, dreq, &dresp)
+	case "save-place":
+		fallthrough
+	case "save-favorite":
+		err = s.savePlace(ctx, dreq, &dresp)
+	case "commute":
+		err = s.commute(ctx, svc, dreq, &dresp)
+	case "save-commute":
+		fallthrough
+	case "save-commute-departures":
+		err = s.saveCommute(ctx, dreq, &dresp)
+	case "when-to-leave":
+		fallthrough
+	case "when-to-leave-with-permission":
+		err = s.whenToLeave(svc, dreq, &dresp)
+	case "last-connection":
+		fallthrough
+	case "last-connection-with-permission":
+		err = s.lastConnection(ctx, svc, dreq, &dresp)
+	case "stops-at":
+		fallthrough
+	case "stops-at-with-permission":
+		err = s.stopsAt(ctx, svc, dreq, &dresp, false)
+	case "arrival-at":
+		fallthrough
+	case "arrival-at-with-permission":
+		err = s.stopsAt(ctx, svc, dreq, &dresp, true)
+	case "vehicle-position":
+		fallthrough
+	case "vehicle-position-with-permission":
+		err = s.vehiclePosition(svc, dreq, &dresp)
+	case "trip-position":
+		err = s.trip(svc, dreq, &dresp, false)
+	case "trip-arrival":
+		err = s.trip(svc, dreq, &dresp, true)
+	case "fare":
+		fallthrough
+	case "fare-with-permission":
+		err = s.fare(ctx, svc, dreq, &dresp)
+	case "disruptions":
+		fallthrough
+	case "disruptions-with-permission":
+		err = s.disruptions(ctx, svc, dreq, &dresp)
+	case "subscribe":
+		err = s.subscribe(ctx, dreq, &dresp)
+	case "unsubscribe":
+		err = s.unsubscribe(ctx, dreq, &dresp)
+	case "station-choice":
+		fallthrough
+	case "station-choice-option":
+		err = s.chooseStation(ctx, svc, dreq, &dresp)
 	case "find-stations":
 		fallthrough
 	case "find-stations-with-permission":
-		err = findStations(svc, dreq, &dresp)
+		err = s.findStations(svc, dreq, &dresp)
 	default:
 		err = fmt.Errorf("Unknown intent %s", dreq.Result.Metadata.IntentName)
 	}
@@ -126,49 +213,23 @@ func dialogflow(writer http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func filterStationsResponse(lresp transport.LocationsResponse, limit int) []localize.Station {
-	stats := []localize.Station{}
-	for _, s := range lresp {
-		if s.Iconclass == "sl-icon-type-adr" || strings.HasPrefix(s.Iconclass, "sl-icon-tel") {
-			// This seems to mean it's a street address.
-			continue
-		}
-		stats = append(stats, localize.Station{Name: s.Label, Distance: s.Dist})
-		if len(stats) == limit {
-			break
-		}
-	}
-	return stats
-}
-
-func findStations(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
-	loc := localize.NewLocalizer(dreq.Lang, timezone)
-	if !(dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude != 0.0 &&
-		dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude != 0.0) {
-		// Request the user location.
-		dresp.Speech = loc.NeedLocation()
-		dresp.Data = &DialogflowResponse_Data{Google: &DialogflowResponse_Data_Google{
-			SystemIntent: &DialogflowResponse_Data_Google_SystemIntent{Intent: "actions.intent.PERMISSION"}}}
-		dresp.Data.Google.SystemIntent.Data.Type = "type.googleapis.com/google.actions.v2.PermissionValueSpec"
-		dresp.Data.Google.SystemIntent.Data.OptContext = loc.PermissionContext()
-		dresp.Data.Google.SystemIntent.Data.Permissions = []string{"DEVICE_PRECISE_LOCATION"}
+func (s *server) findStations(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	if !hasLocation(dreq) {
+		requestLocation(loc, dresp)
 		return nil
 	}
-	lreq := transport.LocationsRequest{
+	limit, _ := dreq.Result.Parameters.Limit.Int64()
+	p := query.Params{
 		Lat: dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
 		Lon: dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
-	}
 
-	lresp, err := svc.Locations(lreq)
-	if err != nil {
-		return fmt.Errorf("Error calling Opendata: %v", err)
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
 	}
-
-	limit := 3
-	if l, _ := dreq.Result.Parameters.Limit.Int64(); l > 0 {
-		limit = int(l)
+	stats, err := query.Stations(svc, p, s.limit(int(limit), s.cfg.Limits.Stations))
+	if err != nil {
+		return err
 	}
-	stats := filterStationsResponse(lresp, limit)
 	dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, stats)
 	// If no results, leave open the conversation.
 	if len(stats) == 0 {
@@ -178,170 +239,89 @@ func findStations(svc transport.Transport, dreq DialogflowRequest, dresp *Dialog
 	return nil
 }
 
-func stationboard(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
-	loc := localize.NewLocalizer(dreq.Lang, timezone)
-	if dreq.Result.Parameters.Source == "" &&
-		!(dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude != 0.0 &&
-			dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude != 0.0) {
+func (s *server) stationboard(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	p := query.Params{
+		Source:      dreq.Result.Parameters.Source,
+		Destination: dreq.Result.Parameters.Destination,
+		Lat:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+		Transport:   dreq.Result.Parameters.Transport,
+		Route:       dreq.Result.Parameters.Route,
+		Via:         dreq.Result.Parameters.Via,
+		StepFree:    dreq.Result.Parameters.StepFree != "",
+		// There's only the one value, "least-crowded".
+		LeastCrowded: dreq.Result.Parameters.Crowding != "",
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	if ok, err := s.resolvePlace(ctx, dreq, loc, dresp, &p); !ok || err != nil {
+		return err
+	}
+	if ok, err := s.resolveStations(svc, dreq, loc, dresp, &p); !ok || err != nil {
+		return err
+	}
+	if p.Source == "" && !hasLocation(dreq) {
 		svc.Logger("Requesting user location...")
-		// Request the user location.
-		dresp.Speech = loc.NeedLocation()
-		dresp.Data = &DialogflowResponse_Data{Google: &DialogflowResponse_Data_Google{
-			SystemIntent: &DialogflowResponse_Data_Google_SystemIntent{Intent: "actions.intent.PERMISSION"}}}
-		dresp.Data.Google.SystemIntent.Data.Type = "type.googleapis.com/google.actions.v2.PermissionValueSpec"
-		dresp.Data.Google.SystemIntent.Data.OptContext = loc.PermissionContext()
-		dresp.Data.Google.SystemIntent.Data.Permissions = []string{"DEVICE_PRECISE_LOCATION"}
+		requestLocation(loc, dresp)
 		return nil
 	}
-	var source string
-	if dreq.Result.Parameters.Source != "" {
-		source = dreq.Result.Parameters.Source
-	} else if dreq.OriginalRequest.Data.Device.Location.FormattedAddress != "" {
+	if p.Source == "" && dreq.OriginalRequest.Data.Device.Location.FormattedAddress != "" {
 		// If the location formatted address is given, we can use it directly.
-		source = dreq.OriginalRequest.Data.Device.Location.FormattedAddress
-	} else {
-		// Sometimes we get coordinates but not a formatted address. I
-		// don't know why. Let's look up the nearest statioan, since
-		// the Transport API does not take coordinates for starting
-		// locations. This is inefficient unfortunately.
-		lreq := transport.LocationsRequest{
-			Lat: dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
-			Lon: dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
-		}
-		lresp, err := svc.Locations(lreq)
-		if err != nil {
-			return fmt.Errorf("Error calling Opendata: %v", err)
-		}
-		stats := filterStationsResponse(lresp, 1)
-		if len(stats) == 0 {
-			// Now we really have no source to start from.
-			dresp.Data = &DialogflowResponse_Data{
-				Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
-			dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, stats)
-			return nil
-		}
-		source = stats[0].Name
-	}
-	// XXX: Dialogflow gives us *either* 15:04:05 OR 2006-01-02T15:04:05Z. I don't know why.
-	startTime := tryParseStupidDate(dreq.Result.Parameters.DateTime)
-
-	// Fill in the departures list to localize from *either* /connections or /stationboard.
-	// This lets us share the localization code.
-	departures := []localize.Departure{}
-
-	if dreq.Result.Parameters.Destination != "" {
-		// Do a /connections RPC.
-		creq := transport.ConnectionsRequest{
-			Station:     source,
-			Destination: dreq.Result.Parameters.Destination,
-			Datetime:    startTime,
-		}
-		cresp, err := svc.Connections(creq)
-		if err != nil {
-			return fmt.Errorf("Error calling Opendata: %v", err)
-		}
-		for _, c := range cresp.Connections {
-			// Find the first non-walking departure leg.
-			for _, l := range c.Legs {
-				// XXX: Probably should warn people if they have to walk somewhere first.
-				// XXX: Not sure what "" type is, but it seems like the last entry sometimes?
-				if l.Type == "walk" || l.Type == "" {
-					continue
-				}
-				d := localize.Departure{
-					From:     l.SbbName,
-					Name:     l.Line,
-					To:       l.Exit.SbbName,
-					Mode:     mode(l.Type),
-					Platform: l.Track,
-				}
-				// For some reason "delay" is sometimes "X". Is this an unknown delay?
-				if l.DepDelay == "" || l.DepDelay == "X" {
-				} else if del, err := strconv.Atoi(l.DepDelay); err != nil {
-					return err
-				} else {
-					d.MinutesDelay = del
-				}
-				if tm, err := time.ParseInLocation("2006-01-02 15:04:05", l.Departure, timezone); err != nil {
-					return err
-				} else {
-					d.Departing = tm
-				}
-				departures = append(departures, d)
-				// Skip the following legs of the journey.
-				// XXX: Probably should say SOMETHING about them.
-				break
-			}
-		}
-	} else {
-		// Do a /stationboard RPC.
-		sreq := transport.StationboardRequest{
-			Station:  source,
-			Mode:     transport.DEPARTURE, // XXX: Hardcoded for now
-			Datetime: startTime,
-		}
-		sresp, err := svc.Stationboard(sreq)
-		if err != nil {
-			return fmt.Errorf("Error calling Opendata: %v", err)
-		}
-		for _, c := range sresp.Connections {
-			d := localize.Departure{
-				From:     sresp.Stop.Name,
-				Name:     c.Line,
-				To:       c.Terminal.Name,
-				Mode:     mode(c.Type),
-				Platform: c.Track,
-			}
-			// For some reason "delay" is sometimes "X". Is this an unknown delay?
-			if c.DepDelay == "" || c.DepDelay == "X" {
-			} else if del, err := strconv.Atoi(c.DepDelay); err != nil {
-				return err
-			} else {
-				d.MinutesDelay = del
-			}
-			if tm, err := time.ParseInLocation("2006-01-02 15:04:05", c.Time, timezone); err != nil {
-				return err
-			} else {
-				d.Departing = tm
-			}
-			departures = append(departures, d)
-		}
+		p.Source = dreq.OriginalRequest.Data.Device.Location.FormattedAddress
 	}
-	limit := 5 // Default
-	if i, err := dreq.Result.Parameters.Limit.Int64(); err == nil {
-		limit = int(i)
+	var ok bool
+	if p.Datetime, p.Until, ok = s.datetime(dreq, loc, dresp); !ok {
+		return nil
 	}
+	limit, _ := dreq.Result.Parameters.Limit.Int64()
+	p.Limit = s.limit(int(limit), s.cfg.Limits.Departures)
+	return s.departures(svc, dreq, dresp, loc, p)
+}
 
-	allowedModes := map[string]bool{}
-	for _, tp := range dreq.Result.Parameters.Transport {
-		allowedModes[tp] = true
+// departures answers with the departures or connections for p.
+func (s *server) departures(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse, loc localize.Localizer, p query.Params) error {
+	// Sometimes we get coordinates but not a formatted address. I don't
+	// know why. In that case, look up the nearest station.
+	source, err := query.Source(svc, p)
+	if err != nil {
+		return err
 	}
+	if source == "" {
+		// Now we really have no source to start from.
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, nil)
+		return nil
+	}
+	p.Source = source
 
-	// Filter "departures."
-	filtered := []localize.Departure{}
-	for _, d := range departures {
-		// If the user specified specific routes, skip on that basis.
-		if len(dreq.Result.Parameters.Route) > 0 {
-			ok := false
-			for _, r := range dreq.Result.Parameters.Route {
-				if d.Name == r {
-					ok = true
-				}
-			}
-			if !ok {
-				continue
-			}
+	// Fill in the departures list to localize from *either* /connections or
+	// /stationboard. This lets us share the localization code.
+	var filtered []localize.Departure
+	var conns []query.Connection
+	// count is how many there are in a window, of which we read the first
+	// p.Limit.
+	count := 0
+	if !p.Until.IsZero() {
+		if filtered, err = query.Window(svc, p, s.tz, time.Now().In(s.tz)); err != nil {
+			return err
 		}
-		// Or if the user specified modes.
-		if len(allowedModes) > 0 {
-			if !allowedModes[d.Mode] {
-				continue
-			}
+		count = len(filtered)
+		if p.Limit > 0 && len(filtered) > p.Limit {
+			filtered = filtered[:p.Limit]
 		}
-		filtered = append(filtered, d)
-		if len(filtered) == limit {
-			break
+	} else if p.Destination != "" {
+		if conns, err = query.Connections(svc, p, s.tz); err != nil {
+			return err
 		}
+		filtered = []localize.Departure{}
+		for _, c := range conns {
+			// XXX: Probably should say SOMETHING about the following legs.
+			filtered = append(filtered, c.Departure())
+		}
+	} else if filtered, err = query.Stationboard(svc, p, s.tz); err != nil {
+		return err
 	}
 	// If no results, leave open the conversation.
 	if len(filtered) == 0 {
@@ -349,6 +329,48 @@ func stationboard(svc transport.Transport, dreq DialogflowRequest, dresp *Dialog
 			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
 	}
 
-	dresp.Speech = loc.NextDepartures(source, dreq.Result.Parameters.Destination, startTime, filtered)
+	speech, ssml := loc.NextDepartures, loc.NextDeparturesSSML
+	if !p.Until.IsZero() {
+		speech = func(from, to string, start time.Time, deps []localize.Departure) string {
+			return loc.WindowDepartures(from, to, start, p.Until, deps, count)
+		}
+		ssml = func(from, to string, start time.Time, deps []localize.Departure) string {
+			return loc.WindowDeparturesSSML(from, to, start, p.Until, deps, count)
+		}
+	}
+	dresp.Speech = speech(source, p.Destination, p.Datetime, filtered)
+	simple := &DialogflowResponse_Data_Google_SimpleResponse{TextToSpeech: dresp.Speech}
+	if s.cfg.Enabled(config.FeatureSSML) {
+		simple = &DialogflowResponse_Data_Google_SimpleResponse{
+			Ssml:        ssml(source, p.Destination, p.Datetime, filtered),
+			DisplayText: dresp.Speech,
+		}
+		dresp.DisplaySpeech = dresp.Speech
+		dresp.Speech = simple.Ssml
+		if dresp.Data == nil {
+			dresp.Data = &DialogflowResponse_Data{Google: &DialogflowResponse_Data_Google{}}
+		}
+		dresp.Data.Google.IsSsml = true
+	}
+	dresp.ContextOut = append(dresp.ContextOut, newDeparturesContext(p, filtered, s.tz))
+	if len(filtered) > 0 && hasScreen(dreq) {
+		rich := &DialogflowResponse_Data_Google_RichResponse{
+			Items:       []DialogflowResponse_Data_Google_Item{{SimpleResponse: simple}},
+			Suggestions: departuresSuggestions(loc, p, filtered),
+		}
+		if len(conns) > 0 {
+			rich.Items = append(rich.Items, DialogflowResponse_Data_Google_Item{
+				BasicCard: connectionCard(loc, conns[0], s.cfg.Endpoints.Connections)})
+		} else {
+			rich.Items = append(rich.Items, DialogflowResponse_Data_Google_Item{
+				TableCard: departuresTable(loc, source, p.Destination, filtered)})
+		}
+		// Suggestions are only shown if we're listening.
+		dresp.Data = &DialogflowResponse_Data{Google: &DialogflowResponse_Data_Google{
+			ExpectUserResponse: len(rich.Suggestions) > 0,
+			IsSsml:             simple.Ssml != "",
+			RichResponse:       rich,
+		}}
+	}
 	return nil
 }
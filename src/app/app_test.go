@@ -0,0 +1,232 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"config"
+	"localize"
+	"query"
+	"users"
+	"when"
+)
+
+func init() {
+	if err := localize.LoadTranslations("../localize/data"); err != nil {
+		panic(err)
+	}
+}
+
+func TestResolveDate(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2018, time.March, day, hour, min, 0, 0, tz)
+	}
+	for _, tc := range []struct {
+		raw  when.Value
+		now  time.Time
+		want time.Time
+	}{
+		{"", at(5, 12, 0), time.Time{}},
+		{"2018-03-07T08:00:00Z", at(5, 12, 0), at(7, 8, 0)},
+		{"18:30:00", at(5, 12, 0), at(5, 18, 30)},
+		{"11:00:00", at(5, 12, 0), at(5, 11, 0)},
+		// Around midnight.
+		{"00:15:00", at(5, 23, 30), at(6, 0, 15)},
+		{"23:45:00", at(6, 0, 30), at(6, 23, 45)},
+		{"00:45:00", at(6, 0, 30), at(6, 0, 45)},
+		// Periods start now if they already have.
+		{"11:00:00/14:00:00", at(5, 12, 0), at(5, 12, 0)},
+		{"2018-03-06", at(5, 12, 0), at(6, 0, 0)},
+		{"in 20 minutes", at(5, 12, 0), at(5, 12, 20)},
+	} {
+		got, _, err := resolveDate(tc.raw, tz, tc.now)
+		if err != nil {
+			t.Errorf("%v at %v: want nil, got '%v'", tc.raw, tc.now, err)
+		} else if !got.Equal(tc.want) {
+			t.Errorf("%v at %v: want %v, got %v", tc.raw, tc.now, tc.want, got)
+		}
+	}
+	if _, _, err := resolveDate("whenever", tz, at(5, 12, 0)); err == nil {
+		t.Errorf("want error, got nil")
+	}
+
+	// Short periods are windows, but whole days aren't.
+	if _, until, _ := resolveDate("17:00:00/18:00:00", tz, at(5, 12, 0)); !until.Equal(at(5, 18, 0)) {
+		t.Errorf("want a window until 18:00, got %v", until)
+	}
+	if _, until, _ := resolveDate("2018-03-06", tz, at(5, 12, 0)); !until.IsZero() {
+		t.Errorf("want no window, got %v", until)
+	}
+}
+
+func TestPickOption(t *testing.T) {
+	options := []string{"Uster, Bahnhofstrasse", "Zug, Bahnhofstrasse", "Zürich, Bahnhofstrasse/HB"}
+	for _, tc := range []struct {
+		said    string
+		ordinal int
+		want    string
+	}{
+		{"", 2, "Zug, Bahnhofstrasse"},
+		{"Uster", 0, "Uster, Bahnhofstrasse"},
+		{"Zürich", 0, "Zürich, Bahnhofstrasse/HB"},
+		{"zuerich bahnhofstrasse", 0, "Zürich, Bahnhofstrasse/HB"},
+		{"Bern", 0, ""},
+		{"", 4, ""},
+	} {
+		if got := pickOption(options, tc.said, tc.ordinal); got != tc.want {
+			t.Errorf("%q, %v: want %q, got %q", tc.said, tc.ordinal, tc.want, got)
+		}
+	}
+}
+
+func TestResolvePlace(t *testing.T) {
+	ctx := context.Background()
+	store := users.NewMemory()
+	s, err := newServer(Env{Users: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := users.User{}
+	u.SavePlace(users.Home, "Stadelhofen")
+	u.SavePlace(users.Work, "Zürich Oerlikon")
+	u.AddFavorite("Uster")
+	if err := store.Put(ctx, "u1", u); err != nil {
+		t.Fatal(err)
+	}
+	loc := localize.NewLocalizer("en", s.tz)
+
+	for _, tc := range []struct {
+		sourcePlace, place, source, destination string
+		wantSource, wantDestination             string
+	}{
+		{"", users.Home, "Zürich HB", "", "Zürich HB", "Stadelhofen"},
+		{users.Work, users.Home, "", "", "Zürich Oerlikon", "Stadelhofen"},
+		{users.Home, "", "", "Bern", "Stadelhofen", "Bern"},
+		// Without a source or location, it's the latest favorite.
+		{"", "", "", "Bern", "Uster", "Bern"},
+		{"", "", "work", "", "Zürich Oerlikon", ""},
+	} {
+		dreq := DialogflowRequest{}
+		dreq.OriginalRequest.Data.User.UserID = "u1"
+		dreq.Result.Parameters.SourcePlace, dreq.Result.Parameters.Place = tc.sourcePlace, tc.place
+		p := query.Params{Source: tc.source, Destination: tc.destination}
+		ok, err := s.resolvePlace(ctx, dreq, loc, &DialogflowResponse{}, &p)
+		if !ok || err != nil {
+			t.Fatalf("want ok, got %v, %v", ok, err)
+		}
+		if p.Source != tc.wantSource || p.Destination != tc.wantDestination {
+			t.Errorf("%+v: want %v to %v, got %v to %v", tc, tc.wantSource, tc.wantDestination, p.Source, p.Destination)
+		}
+	}
+
+	dreq := DialogflowRequest{}
+	dreq.OriginalRequest.Data.User.UserID = "u2"
+	dreq.Result.Parameters.SourcePlace = users.Home
+	dresp := DialogflowResponse{}
+	if ok, err := s.resolvePlace(ctx, dreq, loc, &dresp, &query.Params{}); ok || err != nil {
+		t.Errorf("want an unknown place, got %v, %v", ok, err)
+	}
+	if dresp.Speech == "" {
+		t.Errorf("want the user told, got nothing")
+	}
+}
+
+func TestResolveStations(t *testing.T) {
+	lookups := map[string]int{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		term := r.URL.Query().Get("term")
+		lookups[term]++
+		switch term {
+		case "stadelhofen":
+			fmt.Fprint(w, `[{"label": "Zürich Stadelhofen", "iconclass": "sl-icon-type-train"}]`)
+		case "Bahnhofstrasse":
+			fmt.Fprint(w, `[{"label": "Uster, Bahnhofstrasse", "iconclass": "sl-icon-type-bus"},
+			  {"label": "Zug, Bahnhofstrasse", "iconclass": "sl-icon-type-bus"}]`)
+		default:
+			fmt.Fprintf(w, `[{"label": %q, "iconclass": "sl-icon-type-train"}]`, term)
+		}
+	}))
+	defer upstream.Close()
+	cfg := config.Default()
+	cfg.Endpoints.Locations = upstream.URL
+	cfg.Fares = ""
+	s, err := newServer(Env{Config: &cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, cancel := s.newTransport(context.Background())
+	defer cancel()
+	loc := localize.NewLocalizer("en", s.tz)
+
+	for _, tc := range []struct {
+		source, destination string
+		want                string
+	}{
+		{"stadelhofen", "Uster", "Zürich Stadelhofen"},
+		{"stadelhofen", "Uster", "Zürich Stadelhofen"},
+		// A follow-up carries over the resolved name.
+		{"Zürich Stadelhofen", "Uster", "Zürich Stadelhofen"},
+		{"Bahnhofstrasse", "Uster", ""},
+		{"Bahnhofstrasse", "Uster", ""},
+	} {
+		p := query.Params{Source: tc.source, Destination: tc.destination}
+		ok, err := s.resolveStations(svc, DialogflowRequest{}, loc, &DialogflowResponse{}, &p)
+		if err != nil || ok != (tc.want != "") || (ok && p.Source != tc.want) {
+			t.Errorf("%v: want %q, got %v, %v, %v", tc.source, tc.want, p.Source, ok, err)
+		}
+	}
+	// Each name is only looked up once.
+	if want := map[string]int{"stadelhofen": 1, "Uster": 1, "Bahnhofstrasse": 1}; fmt.Sprint(lookups) != fmt.Sprint(want) {
+		t.Errorf("want lookups %v, got %v", want, lookups)
+	}
+}
+
+func TestSubscribeTime(t *testing.T) {
+	ctx := context.Background()
+	store := users.NewMemory()
+	s, err := newServer(Env{Users: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"", "whenever", "2018-03-06", "07:42:00"} {
+		dreq := DialogflowRequest{Lang: "en"}
+		dreq.OriginalRequest.Data.User.UserID = "u1"
+		dreq.Result.Parameters.Source = "Winterthur"
+		dreq.Result.Parameters.Time = raw
+		dresp := DialogflowResponse{}
+		if err := s.subscribe(ctx, dreq, &dresp); err != nil {
+			t.Errorf("%q: want nil, got '%v'", raw, err)
+		}
+		asked := dresp.Data != nil && dresp.Data.Google != nil && dresp.Data.Google.ExpectUserResponse
+		if want := raw != "07:42:00"; asked != want {
+			t.Errorf("%q: want asked again %v, got '%v'", raw, want, dresp.Speech)
+		}
+	}
+	u, _ := store.Get(ctx, "u1")
+	if len(u.Subscriptions) != 1 || u.Subscriptions[0].Departs != "07:42" {
+		t.Errorf("want the 07:42, got %+v", u.Subscriptions)
+	}
+}
+
+func TestIsWindow(t *testing.T) {
+	for _, tc := range []struct {
+		raw    when.Value
+		window string
+		want   bool
+	}{
+		{"17:00:00/18:00:00", "", true},
+		{"2018-03-06T05:00:00Z/2018-03-06T12:00:00Z", "", false},
+		{"2018-03-06T05:00:00Z/2018-03-06T12:00:00Z", "all", true},
+		{"18:30:00", "", false},
+		{"", "", false},
+	} {
+		if got := isWindow(tc.raw, tc.window); got != tc.want {
+			t.Errorf("%q, %q: want %v, got %v", tc.raw, tc.window, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build appengine
+// +build appengine
+
+package app
+
+import (
+	"net/http"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/urlfetch"
+
+	"config"
+	"users"
+)
+
+func init() {
+	// Configuration comes from $SBB_CONFIG and the environment, which may
+	// be set in app.yaml.
+	cfg, err := config.FromEnv()
+	if err != nil {
+		panic(err)
+	}
+	env := Env{
+		Context: appengine.NewContext,
+		Client:  urlfetch.Client,
+		Infof:   log.Infof,
+		Errorf:  log.Errorf,
+		Config:  &cfg,
+		Users:   users.Datastore{},
+	}
+	h, err := NewHandler(env)
+	if err != nil {
+		panic(err)
+	}
+	http.Handle("/", h)
+	if cfg.Enabled(config.FeatureAlerts) {
+		checker, err := NewChecker(env)
+		if err != nil {
+			panic(err)
+		}
+		// Run by cron.yaml. app.yaml only lets cron and admins in.
+		http.HandleFunc("/tasks/alerts", func(writer http.ResponseWriter, req *http.Request) {
+			ctx := appengine.NewContext(req)
+			if err := checker.Check(ctx); err != nil {
+				log.Errorf(ctx, "Error checking alerts: %v", err)
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+			}
+		})
+	}
+}
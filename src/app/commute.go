@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"localize"
+	"modes"
+	"query"
+	"transport"
+	"users"
+)
+
+// parseTimePeriod parses a Dialogflow @sys.time-period, e.g.
+// "07:00:00/08:30:00", into "15:04" times. Both are "" if raw isn't one.
+func parseTimePeriod(raw string) (start, end string) {
+	parts := strings.Split(raw, "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	s, err := time.Parse("15:04:05", parts[0])
+	if err != nil {
+		return "", ""
+	}
+	e, err := time.Parse("15:04:05", parts[1])
+	if err != nil {
+		return "", ""
+	}
+	return s.Format("15:04"), e.Format("15:04")
+}
+
+// commute handles "my commute" by asking for the saved commute's
+// departures, from when its window next opens.
+func (s *server) commute(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	if dreq.OriginalRequest.Data.User.UserID == "" {
+		dresp.Speech = loc.NoUser()
+		return nil
+	}
+	u, err := s.user(ctx, dreq)
+	if err != nil {
+		return err
+	}
+	c, ok := u.Commute(dreq.Result.Parameters.Name)
+	if !ok {
+		dresp.Speech = loc.UnknownCommute()
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		return nil
+	}
+	p := query.Params{
+		Source:      c.Source,
+		Destination: c.Destination,
+		Transport:   c.Transport,
+		Route:       c.Route,
+		Datetime:    c.Next(time.Now().In(s.tz)),
+		Limit:       s.cfg.Limits.Departures,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	return s.departures(svc, dreq, dresp, loc, p)
+}
+
+// saveCommute handles "my commute is the tram 4 from Stadelhofen to
+// Bellevue between 7 and 8" and, after a query, "save this as my commute".
+func (s *server) saveCommute(ctx context.Context, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	id := dreq.OriginalRequest.Data.User.UserID
+	if id == "" {
+		dresp.Speech = loc.NoUser()
+		return nil
+	}
+	u, err := s.env.Users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	params := dreq.Result.Parameters
+	c := users.Commute{
+		Source:      params.Source,
+		Destination: params.Destination,
+		Route:       params.Route,
+	}
+	for _, t := range params.Transport {
+		// "any" is the @transport entity's default, and no filter.
+		if modes.Parse(t) != modes.Unknown {
+			c.Transport = append(c.Transport, t)
+		}
+	}
+	c.Start, c.End = parseTimePeriod(params.TimePeriod)
+	u.SaveCommute(params.Name, c)
+	if err := s.env.Users.Put(ctx, id, u); err != nil {
+		return err
+	}
+	dresp.Speech = loc.CommuteSaved(c.Source, c.Destination)
+	return nil
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// disruptions handles "are there any disruptions on the S8?".
+func (s *server) disruptions(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	p := query.Params{
+		Source:    dreq.Result.Parameters.Source,
+		Lat:       dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:       dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+		Transport: dreq.Result.Parameters.Transport,
+		Route:     dreq.Result.Parameters.Route,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	if ok, err := s.resolvePlace(ctx, dreq, loc, dresp, &p); !ok || err != nil {
+		return err
+	}
+	if p.Source == "" && !hasLocation(dreq) {
+		requestLocation(loc, dresp)
+		return nil
+	}
+	source, err := query.Source(svc, p)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, nil)
+		return nil
+	}
+	p.Source = source
+
+	ds, err := query.Disruptions(svc, p, s.tz, time.Now().In(s.tz))
+	if err != nil {
+		return err
+	}
+	dresp.Speech = loc.Disruptions(strings.Join(p.Route, ", "), source, ds)
+	return nil
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// fare handles "how much is a ticket from Bern to Basel?", optionally with
+// a half-fare card or GA.
+func (s *server) fare(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	p := query.Params{
+		Source:      dreq.Result.Parameters.Source,
+		Destination: dreq.Result.Parameters.Destination,
+		Lat:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	var ok bool
+	if p.Datetime, _, ok = s.datetime(dreq, loc, dresp); !ok {
+		return nil
+	}
+	if ok, err := s.resolvePlace(ctx, dreq, loc, dresp, &p); !ok || err != nil {
+		return err
+	}
+	if p.Source == "" && !hasLocation(dreq) {
+		requestLocation(loc, dresp)
+		return nil
+	}
+	source, err := query.Source(svc, p)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, nil)
+		return nil
+	}
+	p.Source = source
+
+	discount := dreq.Result.Parameters.Discount
+	var f *localize.Fare
+	if discount != "ga" {
+		if f, err = query.Fare(svc, p, s.env.Fares, s.tz); err != nil {
+			return err
+		}
+	}
+	dresp.Speech = loc.Fare(source, p.Destination, f, discount)
+	return nil
+}
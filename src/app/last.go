@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// lastConnection handles "what's the last train home tonight?".
+func (s *server) lastConnection(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	p := query.Params{
+		Source:      dreq.Result.Parameters.Source,
+		Destination: dreq.Result.Parameters.Destination,
+		Lat:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+		Transport:   dreq.Result.Parameters.Transport,
+		Route:       dreq.Result.Parameters.Route,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	var ok bool
+	if p.Datetime, _, ok = s.datetime(dreq, loc, dresp); !ok {
+		return nil
+	}
+	if ok, err := s.resolvePlace(ctx, dreq, loc, dresp, &p); !ok || err != nil {
+		return err
+	}
+	if p.Source == "" && !hasLocation(dreq) {
+		requestLocation(loc, dresp)
+		return nil
+	}
+	source, err := query.Source(svc, p)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, nil)
+		return nil
+	}
+	p.Source = source
+
+	tonight, err := query.LastConnection(svc, p, s.tz, time.Now().In(s.tz))
+	if err != nil {
+		return err
+	}
+	var last, first *localize.Departure
+	if tonight.Last != nil {
+		d := tonight.Last.Departure()
+		last = &d
+	}
+	if tonight.First != nil {
+		d := tonight.First.Departure()
+		first = &d
+	}
+	night := []localize.Departure{}
+	supplement := false
+	for _, c := range tonight.Night {
+		night = append(night, c.Departure())
+		supplement = supplement || c.Supplement
+	}
+	dresp.Speech = loc.LastConnection(source, p.Destination, last, night, supplement, first)
+	return nil
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"math"
+	"time"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// whenToLeave handles "when do I have to leave to catch the next train to
+// Zürich?", walking from the device's location.
+func (s *server) whenToLeave(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	if !hasLocation(dreq) {
+		requestLocation(loc, dresp)
+		return nil
+	}
+	p := query.Params{
+		Source:      dreq.Result.Parameters.Source,
+		Destination: dreq.Result.Parameters.Destination,
+		Lat:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:         dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+		Transport:   dreq.Result.Parameters.Transport,
+		Route:       dreq.Result.Parameters.Route,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	var ok bool
+	if p.Datetime, _, ok = s.datetime(dreq, loc, dresp); !ok {
+		return nil
+	}
+	now := time.Now().In(s.tz)
+	plan, ok, err := query.PlanLeave(svc, p, s.cfg.Walking.Speed, time.Duration(s.cfg.Walking.Buffer), now, s.tz)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		dresp.Speech = loc.NextDepartures(p.Source, p.Destination, p.Datetime, nil)
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		return nil
+	}
+	// Round down: better a minute early than a minute late.
+	minutes := int(math.Floor(plan.Leave.Sub(now).Minutes()))
+	dresp.Speech = loc.Leave(minutes, plan.Station.Name, plan.Departure)
+	return nil
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+
+	"localize"
+	"query"
+	"users"
+)
+
+// user loads the user making dreq. Requests without a user ID get the zero
+// User, which has no favorites or places.
+func (s *server) user(ctx context.Context, dreq DialogflowRequest) (users.User, error) {
+	id := dreq.OriginalRequest.Data.User.UserID
+	if id == "" {
+		return users.User{}, nil
+	}
+	return s.env.Users.Get(ctx, id)
+}
+
+// resolvePlace resolves the user's saved places in dreq: the place, e.g. for
+// "next train home", is p.Destination and the source place, e.g. for "from
+// work", is p.Source. A source or destination which is itself the name of a
+// place is resolved too. Without a source or the device's location, the
+// user's latest favorite is the source. If a place isn't one we know, it
+// answers dresp and returns false.
+func (s *server) resolvePlace(ctx context.Context, dreq DialogflowRequest, loc localize.Localizer, dresp *DialogflowResponse, p *query.Params) (bool, error) {
+	user, err := s.user(ctx, dreq)
+	if err != nil {
+		return false, err
+	}
+	for _, x := range []struct {
+		place   string
+		station *string
+	}{
+		{dreq.Result.Parameters.SourcePlace, &p.Source},
+		{dreq.Result.Parameters.Place, &p.Destination},
+	} {
+		if x.place == "" {
+			*x.station = user.Resolve(*x.station)
+			continue
+		}
+		if *x.station = user.Place(x.place); *x.station == "" {
+			dresp.Speech = loc.UnknownPlace(x.place)
+			dresp.Data = &DialogflowResponse_Data{
+				Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+			return false, nil
+		}
+	}
+	if p.Source == "" && !hasLocation(dreq) && len(user.Favorites) > 0 {
+		p.Source = user.Favorites[0]
+	}
+	return true, nil
+}
+
+// savePlace handles "save Stadelhofen as home" and, without a place, "save
+// Stadelhofen as a favorite".
+func (s *server) savePlace(ctx context.Context, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	id := dreq.OriginalRequest.Data.User.UserID
+	if id == "" {
+		dresp.Speech = loc.NoUser()
+		return nil
+	}
+	u, err := s.env.Users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	station, place := dreq.Result.Parameters.Source, dreq.Result.Parameters.Place
+	if station == "" {
+		dresp.Speech = loc.WhichStationToSave(place)
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		return nil
+	}
+	if place != "" {
+		u.SavePlace(place, station)
+		dresp.Speech = loc.PlaceSaved(place, station)
+	} else {
+		u.AddFavorite(station)
+		dresp.Speech = loc.FavoriteSaved(station)
+	}
+	return s.env.Users.Put(ctx, id, u)
+}
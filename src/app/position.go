@@ -0,0 +1,50 @@
+package app
+
+import (
+	"time"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// vehiclePosition handles "where is the 7 tram?": where the next one on its
+// way to the user's station is.
+func (s *server) vehiclePosition(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	p := query.Params{
+		Source:    dreq.Result.Parameters.Source,
+		Lat:       dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:       dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+		Transport: dreq.Result.Parameters.Transport,
+		Route:     dreq.Result.Parameters.Route,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	if p.Source == "" && !hasLocation(dreq) {
+		requestLocation(loc, dresp)
+		return nil
+	}
+	source, err := query.Source(svc, p)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, nil)
+		return nil
+	}
+	p.Source = source
+
+	run, pos, err := query.Approaching(svc, p, s.tz, time.Now().In(s.tz))
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		dresp.Speech = loc.VehiclePosition(localize.Departure{}, source, nil)
+		return nil
+	}
+	dresp.Speech = loc.VehiclePosition(*run, source, &pos)
+	return nil
+}
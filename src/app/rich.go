@@ -0,0 +1,143 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"localize"
+	"modes"
+	"query"
+)
+
+// The "departures" context carries the last stationboard query into the
+// follow-up intents offered as suggestion chips: departures-more,
+// departures-mode-only and return-trip.
+const departuresContext = "departures"
+
+// hasScreen returns whether the device can show cards and chips.
+func hasScreen(dreq DialogflowRequest) bool {
+	for _, c := range dreq.OriginalRequest.Data.Surface.Capabilities {
+		if c.Name == "actions.capability.SCREEN_OUTPUT" {
+			return true
+		}
+	}
+	return false
+}
+
+func formatDelay(d localize.Departure) string {
+	if d.MinutesDelay < 1 {
+		return ""
+	}
+	return fmt.Sprintf("+%d'", d.MinutesDelay)
+}
+
+// formatPlatform marks a changed platform, like the boards in stations do.
+func formatPlatform(d localize.Departure) string {
+	if d.PlatformChanged && d.Platform != "" {
+		return d.Platform + "!"
+	}
+	return d.Platform
+}
+
+func departuresTable(loc localize.Localizer, from, to string, deps []localize.Departure) *DialogflowResponse_Data_Google_TableCard {
+	card := &DialogflowResponse_Data_Google_TableCard{Title: loc.DeparturesTitle(from, to)}
+	for i, h := range loc.DepartureColumns() {
+		col := DialogflowResponse_Data_Google_TableCard_Column{Header: h}
+		if i >= 2 {
+			// Time, delay and platform.
+			col.HorizontalAlignment = "TRAILING"
+		}
+		card.ColumnProperties = append(card.ColumnProperties, col)
+	}
+	for _, d := range deps {
+		row := DialogflowResponse_Data_Google_TableCard_Row{}
+		for _, c := range []string{d.Name, d.To, d.Departing.In(loc.Timezone()).Format("15:04"), formatDelay(d), formatPlatform(d)} {
+			row.Cells = append(row.Cells, DialogflowResponse_Data_Google_TableCard_Cell{Text: c})
+		}
+		card.Rows = append(card.Rows, row)
+	}
+	return card
+}
+
+// connectionCard shows the legs of c, with a link to search.ch. base is the
+// connections endpoint, which c.URL may be relative to.
+func connectionCard(loc localize.Localizer, c query.Connection, base string) *DialogflowResponse_Data_Google_BasicCard {
+	legs := []string{}
+	for _, l := range c.Legs {
+		legs = append(legs, loc.Leg(l))
+	}
+	card := &DialogflowResponse_Data_Google_BasicCard{
+		Title:    fmt.Sprintf("%s → %s", c.From, c.To),
+		Subtitle: loc.ConnectionTimes(c.Departing, c.Arriving),
+		// Two trailing spaces are a line break in the card's markdown.
+		FormattedText: strings.Join(legs, "  \n"),
+	}
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if b, berr := url.Parse(base); err == nil && berr == nil {
+			btn := DialogflowResponse_Data_Google_Button{Title: loc.OpenOnSearchCh()}
+			btn.OpenURLAction.URL = b.ResolveReference(u).String()
+			card.Buttons = append(card.Buttons, btn)
+		}
+	}
+	return card
+}
+
+// departuresSuggestions offers the follow-ups which make sense for p and its
+// results.
+func departuresSuggestions(loc localize.Localizer, p query.Params, deps []localize.Departure) []DialogflowResponse_Data_Google_Suggestion {
+	s := []DialogflowResponse_Data_Google_Suggestion{}
+	if len(deps) == p.Limit {
+		// There are probably more.
+		s = append(s, DialogflowResponse_Data_Google_Suggestion{Title: loc.SuggestMore()})
+	}
+	if p.Destination == "" {
+		trams, others := false, false
+		for _, d := range deps {
+			if d.Mode == modes.Tram {
+				trams = true
+			} else {
+				others = true
+			}
+		}
+		if trams && others {
+			s = append(s, DialogflowResponse_Data_Google_Suggestion{Title: loc.SuggestTramsOnly()})
+		}
+	} else {
+		s = append(s, DialogflowResponse_Data_Google_Suggestion{Title: loc.SuggestReturnTrip()})
+	}
+	return s
+}
+
+// newDeparturesContext remembers p for the follow-up intents. "after" is
+// when to continue from for "more".
+func newDeparturesContext(p query.Params, deps []localize.Departure, tz *time.Location) DialogflowResponse_Context {
+	params := map[string]interface{}{
+		"source":      p.Source,
+		"destination": p.Destination,
+		"transport":   p.Transport,
+		"route":       p.Route,
+		"limit":       p.Limit,
+	}
+	if p.StepFree {
+		params["step-free"] = "step-free"
+	}
+	if p.LeastCrowded {
+		params["crowding"] = "least-crowded"
+	}
+	// Dialogflow's "Z" isn't really UTC; see package when.
+	if !p.Datetime.IsZero() {
+		params["date-time"] = p.Datetime.In(tz).Format("2006-01-02T15:04:05Z")
+	}
+	if len(deps) > 0 {
+		after := deps[len(deps)-1].Departing.Add(1 * time.Minute)
+		params["after"] = after.In(tz).Format("2006-01-02T15:04:05Z")
+		// "Where is that train now?" is about the first one.
+		if deps[0].TripID != "" {
+			params["trip"] = deps[0].TripID
+		}
+	}
+	return DialogflowResponse_Context{Name: departuresContext, Lifespan: 2, Parameters: params}
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"alerts"
+	"config"
+	"fares"
+	"gazetteer"
+	"localize"
+	"query"
+	"transport"
+	"users"
+)
+
+// Env is the platform the app runs on. The App Engine glue lives in
+// appengine.go; cmd/sbb-server runs the app as a plain net/http server.
+type Env struct {
+	// Context returns the context to serve req in. Defaults to req.Context().
+	Context func(req *http.Request) context.Context
+	// Client returns the HTTP client for calls to the timetable API.
+	// Defaults to http.DefaultClient.
+	Client func(ctx context.Context) *http.Client
+	// Infof and Errorf log. They default to the standard logger.
+	Infof  func(ctx context.Context, format string, args ...interface{})
+	Errorf func(ctx context.Context, format string, args ...interface{})
+	// Config is the deployment configuration. Defaults to config.Default().
+	Config *config.Config
+	// Users stores favorites, named places and subscriptions. Defaults to
+	// an in-memory store.
+	Users users.Store
+	// Notifier delivers alerts. Defaults to posting to the configured
+	// webhook if there is one, or logging them otherwise.
+	Notifier alerts.Notifier
+	// Stations is the station index. Defaults to loading the configured
+	// gazetteer if there is one; without it, station names are passed to
+	// the timetable API as they are.
+	Stations *gazetteer.Index
+	// Fares are the zone fare tables. Defaults to loading the configured
+	// ones if there are any; without them, only the timetable API's prices
+	// are given.
+	Fares *fares.Tariffs
+}
+
+type server struct {
+	env Env
+	cfg config.Config
+	tz  *time.Location
+	// resolved are the station names resolveStations has resolved.
+	resolved *stationCache
+}
+
+func newServer(env Env) (*server, error) {
+	if env.Context == nil {
+		env.Context = func(req *http.Request) context.Context { return req.Context() }
+	}
+	if env.Client == nil {
+		env.Client = func(context.Context) *http.Client { return http.DefaultClient }
+	}
+	if env.Infof == nil {
+		env.Infof = func(_ context.Context, f string, xs ...interface{}) { log.Printf("INFO: "+f, xs...) }
+	}
+	if env.Users == nil {
+		env.Users = users.NewMemory()
+	}
+	if env.Errorf == nil {
+		env.Errorf = func(_ context.Context, f string, xs ...interface{}) { log.Printf("ERROR: "+f, xs...) }
+	}
+	cfg := config.Default()
+	if env.Config != nil {
+		cfg = *env.Config
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	tz, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	if env.Notifier == nil {
+		if cfg.Alerts.Webhook != "" {
+			env.Notifier = alerts.Webhook{URL: cfg.Alerts.Webhook, Client: env.Client}
+		} else {
+			env.Notifier = &alerts.Mail{W: os.Stderr}
+		}
+	}
+	if env.Stations == nil && cfg.Gazetteer != "" {
+		if env.Stations, err = gazetteer.Load(cfg.Gazetteer); err != nil {
+			return nil, fmt.Errorf("loading gazetteer: %v", err)
+		}
+	}
+	if env.Fares == nil && cfg.Fares != "" {
+		env.Fares, err = fares.Load(cfg.Fares)
+		// Like the translations, the default table is only there if
+		// deploy.sh put it there.
+		if os.IsNotExist(err) && cfg.Fares == config.Default().Fares {
+			err = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading fares: %v", err)
+		}
+	}
+	return &server{env: env, cfg: cfg, tz: tz, resolved: newStationCache()}, nil
+}
+
+// NewHandler returns a handler serving the Dialogflow webhook and the JSON
+// API in env.
+func NewHandler(env Env) (http.Handler, error) {
+	s, err := newServer(env)
+	if err != nil {
+		return nil, err
+	}
+	cfg := s.cfg
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dialogflow", s.dialogflow)
+	if cfg.Enabled(config.FeatureAPI) {
+		mux.HandleFunc("/api/v1/departures", s.apiDepartures)
+		mux.HandleFunc("/api/v1/connections", s.apiConnections)
+		mux.HandleFunc("/api/v1/trip", s.apiTrip)
+		mux.HandleFunc("/api/v1/stations/nearby", s.apiNearbyStations)
+	}
+	if cfg.Enabled(config.FeatureDebugConfig) {
+		mux.HandleFunc("/debug/config", s.debugConfig)
+	}
+	return mux, nil
+}
+
+// NewChecker returns a checker for the alerts subscribed to in env. The
+// caller runs it, e.g. from cron or with alerts.Run.
+func NewChecker(env Env) (*alerts.Checker, error) {
+	s, err := newServer(env)
+	if err != nil {
+		return nil, err
+	}
+	return &alerts.Checker{
+		Users: s.env.Users,
+		Departures: func(ctx context.Context, p query.Params) ([]localize.Departure, error) {
+			svc, cancel := s.newTransport(ctx)
+			defer cancel()
+			return query.Departures(svc, p, s.tz)
+		},
+		Notifier:  s.env.Notifier,
+		Timezone:  s.tz,
+		Lookahead: time.Duration(s.cfg.Alerts.Lookahead),
+		MinDelay:  s.cfg.Alerts.MinDelay,
+	}, nil
+}
+
+// limit returns n, or def if n isn't positive, but no more than the
+// configured maximum.
+func (s *server) limit(n, def int) int {
+	if n <= 0 {
+		n = def
+	}
+	if n > s.cfg.Limits.Max {
+		n = s.cfg.Limits.Max
+	}
+	return n
+}
+
+// debugConfig dumps the effective configuration, without credentials.
+func (s *server) debugConfig(writer http.ResponseWriter, req *http.Request) {
+	s.writeJSON(writer, req, http.StatusOK, s.cfg.Redacted())
+}
+
+func (s *server) infof(req *http.Request, f string, xs ...interface{}) {
+	s.env.Infof(s.env.Context(req), f, xs...)
+}
+
+func (s *server) errorf(req *http.Request, f string, xs ...interface{}) {
+	s.env.Errorf(s.env.Context(req), f, xs...)
+}
+
+func (s *server) newTransport(ctx context.Context) (transport.Transport, context.CancelFunc) {
+	timeout := time.Duration(s.cfg.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	client := *s.env.Client(ctx)
+	// The standard library client doesn't take a context, so bound it
+	// with a timeout instead. (urlfetch's client uses ctx.)
+	if client.Timeout == 0 || client.Timeout > timeout {
+		client.Timeout = timeout
+	}
+	return transport.Transport{
+		Client: &client,
+		Logger: func(x string) { s.env.Infof(ctx, "%s", x) },
+		Endpoints: transport.Endpoints{
+			Stationboard: s.cfg.Endpoints.Stationboard,
+			Connections:  s.cfg.Endpoints.Connections,
+			Locations:    s.cfg.Endpoints.Locations,
+			Occupancy:    s.cfg.Endpoints.Occupancy,
+			Trip:         s.cfg.Endpoints.Trip,
+		},
+	}, cancel
+}
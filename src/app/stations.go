@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"gazetteer"
+	"localize"
+	"query"
+	"transport"
+)
+
+// The "station_choice" context carries a departures query whose source or
+// destination was ambiguous into the station-choice intents, which ask
+// which station was meant and then answer the query.
+const stationChoiceContext = "station_choice"
+
+// station returns the official name of the station called name, if the
+// gazetteer knows it, e.g. "Zürich HB" for "zuerich hauptbahnhof".
+// Otherwise, it's left to the timetable API.
+func (s *server) station(name string) string {
+	if s.env.Stations == nil || name == "" {
+		return name
+	}
+	if st, ok := s.env.Stations.Lookup(name); ok {
+		return st.Name
+	}
+	return name
+}
+
+// maxResolved bounds how many names a stationCache remembers.
+const maxResolved = 1000
+
+// stationCache remembers what station names resolved to, since without a
+// gazetteer each name takes a timetable API call.
+type stationCache struct {
+	mu    sync.Mutex
+	names map[string]query.Resolution
+}
+
+func newStationCache() *stationCache {
+	return &stationCache{names: map[string]query.Resolution{}}
+}
+
+// resolve is query.ResolveStation, but only calls it for names it hasn't
+// resolved before. A station resolved to resolves to itself, so queries
+// carried over from an earlier one don't look it up again.
+func (c *stationCache) resolve(svc transport.Transport, name string, ix *gazetteer.Index, ignored []string) (query.Resolution, error) {
+	key := gazetteer.Normalize(name)
+	c.mu.Lock()
+	r, ok := c.names[key]
+	c.mu.Unlock()
+	if ok || name == "" {
+		return r, nil
+	}
+	r, err := query.ResolveStation(svc, name, ix, ignored)
+	if err != nil {
+		return r, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.names) >= maxResolved {
+		c.names = map[string]query.Resolution{}
+	}
+	c.names[key] = r
+	if len(r.Candidates) == 0 {
+		c.names[gazetteer.Normalize(r.Station)] = query.Resolution{Station: r.Station}
+	}
+	return r, nil
+}
+
+// resolveStations resolves loose station names in p, e.g. "Bahnhof
+// Oerlikon". If one is ambiguous, like "Bahnhofstrasse", dresp asks which
+// was meant and ok is false.
+func (s *server) resolveStations(svc transport.Transport, dreq DialogflowRequest, loc localize.Localizer, dresp *DialogflowResponse, p *query.Params) (ok bool, err error) {
+	for _, f := range []struct {
+		param string
+		name  *string
+	}{{"source", &p.Source}, {"destination", &p.Destination}} {
+		r, err := s.resolved.resolve(svc, *f.name, s.env.Stations, p.IgnoredIconClasses)
+		if err != nil {
+			return false, err
+		}
+		if len(r.Candidates) > 0 {
+			askStation(dreq, loc, dresp, f.param, *f.name, r.Candidates)
+			return false, nil
+		}
+		*f.name = r.Station
+	}
+	return true, nil
+}
+
+// askStation asks which of options the user meant by name, which was given
+// as param, with a list to choose from on screens.
+func askStation(dreq DialogflowRequest, loc localize.Localizer, dresp *DialogflowResponse, param, name string, options []string) {
+	dresp.Speech = loc.WhichStation(name, options)
+	dresp.Data = &DialogflowResponse_Data{
+		Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+	if hasScreen(dreq) {
+		list := &DialogflowResponse_Data_Google_ListSelect{Title: loc.WhichStationTitle(name)}
+		for _, o := range options {
+			item := DialogflowResponse_Data_Google_OptionItem{Title: o}
+			item.OptionInfo.Key = o
+			list.Items = append(list.Items, item)
+		}
+		intent := &DialogflowResponse_Data_Google_SystemIntent{Intent: "actions.intent.OPTION"}
+		intent.Data.Type = "type.googleapis.com/google.actions.v2.OptionValueSpec"
+		intent.Data.ListSelect = list
+		dresp.Data.Google.SystemIntent = intent
+	}
+	params := dreq.Result.Parameters
+	carried := map[string]interface{}{
+		"choice":      param,
+		"name":        name,
+		"options":     options,
+		"source":      params.Source,
+		"destination": params.Destination,
+		"via":         params.Via,
+		"step-free":   params.StepFree,
+		"crowding":    params.Crowding,
+		"transport":   params.Transport,
+		"route":       params.Route,
+		"date-time":   string(params.DateTime),
+	}
+	if params.Limit != "" {
+		carried["limit"] = params.Limit
+	}
+	dresp.ContextOut = append(dresp.ContextOut, DialogflowResponse_Context{
+		Name: stationChoiceContext, Lifespan: 2, Parameters: carried})
+}
+
+// chooseStation handles the answer to askStation: an item picked from the
+// list, a station name, or "the second one". It then answers the original
+// query.
+func (s *server) chooseStation(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	params := &dreq.Result.Parameters
+	chosen := ""
+	for _, in := range dreq.OriginalRequest.Data.Inputs {
+		for _, a := range in.Arguments {
+			if a.Name == "OPTION" {
+				chosen = a.TextValue
+			}
+		}
+	}
+	if chosen == "" {
+		ordinal, _ := params.Ordinal.Int64()
+		chosen = pickOption(params.Options, params.Station, int(ordinal))
+	}
+	if chosen == "" {
+		loc := localize.NewLocalizer(dreq.Lang, s.tz)
+		askStation(dreq, loc, dresp, params.Choice, params.Name, params.Options)
+		return nil
+	}
+	if params.Choice == "destination" {
+		params.Destination = chosen
+	} else {
+		params.Source = chosen
+	}
+	return s.stationboard(ctx, svc, dreq, dresp)
+}
+
+// pickOption returns the ordinal'th option, counting from 1, or the one
+// said, or "" if neither matches.
+func pickOption(options []string, said string, ordinal int) string {
+	if ordinal >= 1 && ordinal <= len(options) {
+		return options[ordinal-1]
+	}
+	best, chosen := 0.0, ""
+	for _, o := range options {
+		if score := gazetteer.Similarity(said, o); score > best && score >= 0.6 {
+			best, chosen = score, o
+		}
+	}
+	return chosen
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// stopsAt handles "does the next S5 stop in Uster?" and, if arrival is set,
+// "when does the 15:04 arrive in Winterthur?".
+func (s *server) stopsAt(ctx context.Context, svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse, arrival bool) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	p := query.Params{
+		Source:    dreq.Result.Parameters.Source,
+		Lat:       dreq.OriginalRequest.Data.Device.Location.Coordinates.Latitude,
+		Lon:       dreq.OriginalRequest.Data.Device.Location.Coordinates.Longitude,
+		Transport: dreq.Result.Parameters.Transport,
+		Route:     dreq.Result.Parameters.Route,
+
+		IgnoredIconClasses: s.cfg.IgnoredIconClasses,
+	}
+	var ok bool
+	if p.Datetime, _, ok = s.datetime(dreq, loc, dresp); !ok {
+		return nil
+	}
+	if ok, err := s.resolvePlace(ctx, dreq, loc, dresp, &p); !ok || err != nil {
+		return err
+	}
+	if p.Source == "" && !hasLocation(dreq) {
+		requestLocation(loc, dresp)
+		return nil
+	}
+	source, err := query.Source(svc, p)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		dresp.Speech = loc.Stations(dreq.OriginalRequest.Data.Device.Location.FormattedAddress, nil)
+		return nil
+	}
+	p.Source = source
+	if p.Datetime.IsZero() {
+		p.Datetime = time.Now().In(s.tz)
+	}
+
+	via := dreq.Result.Parameters.Via
+	call, err := query.NextCall(svc, p, via, s.tz)
+	if err != nil {
+		return err
+	}
+	switch {
+	case call == nil:
+		dresp.Speech = loc.NextDepartures(source, "", p.Datetime, nil)
+	case arrival:
+		dresp.Speech = loc.ArrivesAt(call.Departure, via, call.Stop)
+	default:
+		dresp.Speech = loc.StopsAt(call.Departure, via, call.Stop)
+	}
+	return nil
+}
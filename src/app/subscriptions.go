@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+
+	"localize"
+	"users"
+	"when"
+)
+
+// subscribe handles "tell me if the S12 at 7:42 from Winterthur is delayed
+// on weekdays".
+func (s *server) subscribe(ctx context.Context, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	id := dreq.OriginalRequest.Data.User.UserID
+	if id == "" {
+		dresp.Speech = loc.NoUser()
+		return nil
+	}
+	params := dreq.Result.Parameters
+	r := when.Resolver{Location: s.tz}
+	departs, err := r.Resolve(params.Time)
+	if err != nil || departs.IsZero() || !departs.End.Equal(departs.Start) {
+		// Not a time of day, e.g. "tomorrow", so ask again.
+		if params.Time == "" {
+			dresp.Speech = loc.SubscriptionTimeNeeded()
+		} else {
+			dresp.Speech = loc.UnknownTime(params.Time)
+		}
+		dresp.Data = &DialogflowResponse_Data{
+			Google: &DialogflowResponse_Data_Google{ExpectUserResponse: true}}
+		return nil
+	}
+	sub := users.Subscription{
+		Source:      params.Source,
+		Destination: params.Destination,
+		Departs:     departs.Start.In(s.tz).Format("15:04"),
+		Days:        users.ParseDays(params.Days),
+		Lang:        dreq.Lang,
+	}
+	if len(params.Route) > 0 {
+		sub.Route = params.Route[0]
+	}
+	if d, err := params.Delay.Int64(); err == nil {
+		sub.MinDelay = int(d)
+	}
+	u, err := s.env.Users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	u.Subscribe(sub)
+	if err := s.env.Users.Put(ctx, id, u); err != nil {
+		return err
+	}
+	dresp.Speech = loc.Subscribed(sub.Source, sub.Departs)
+	return nil
+}
+
+// unsubscribe handles "stop the alerts", for all subscriptions.
+func (s *server) unsubscribe(ctx context.Context, dreq DialogflowRequest, dresp *DialogflowResponse) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	id := dreq.OriginalRequest.Data.User.UserID
+	if id == "" {
+		dresp.Speech = loc.NoUser()
+		return nil
+	}
+	u, err := s.env.Users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	u.Subscriptions = nil
+	if err := s.env.Users.Put(ctx, id, u); err != nil {
+		return err
+	}
+	dresp.Speech = loc.Unsubscribed()
+	return nil
+}
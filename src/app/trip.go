@@ -0,0 +1,49 @@
+package app
+
+import (
+	"time"
+
+	"localize"
+	"query"
+	"transport"
+)
+
+// trip handles the follow-ups about the departure we last told of: "where
+// is that train now?" and, if arrival is set, "what time does it reach
+// Olten?".
+func (s *server) trip(svc transport.Transport, dreq DialogflowRequest, dresp *DialogflowResponse, arrival bool) error {
+	loc := localize.NewLocalizer(dreq.Lang, s.tz)
+	id := dreq.Result.Parameters.Trip
+	if id == "" {
+		dresp.Speech = loc.TripUnknown()
+		return nil
+	}
+	d, err := query.Trip(svc, id, s.tz)
+	if err == query.ErrNoTrip {
+		dresp.Speech = loc.TripUnknown()
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if arrival {
+		via := dreq.Result.Parameters.Via
+		var stop *localize.Stop
+		if st, ok := query.StopAt(d, via); ok {
+			stop = &st
+		}
+		dresp.Speech = loc.ArrivesAt(d, via, stop)
+		return nil
+	}
+	now := time.Now().In(s.tz)
+	// If it's still on its way to where they asked about, say how far it
+	// is from there.
+	if source := dreq.Result.Parameters.Source; source != "" {
+		if pos, ok := query.Locate(d, source, now); ok {
+			dresp.Speech = loc.VehiclePosition(d, source, &pos)
+			return nil
+		}
+	}
+	last, next := query.Progress(d, now)
+	dresp.Speech = loc.TripPosition(d, last, next)
+	return nil
+}
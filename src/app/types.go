@@ -3,6 +3,8 @@ package app
 import (
 	"encoding/json"
 	"time"
+
+	"when"
 )
 
 type DialogflowRequest struct {
@@ -17,11 +19,28 @@ type DialogflowRequest struct {
 		Parameters       struct {
 			Source      string      `json:"source"`
 			Destination string      `json:"destination"`
+			Via         string      `json:"via"`
 			Transport   []string    `json:"transport"`
 			Route       []string    `json:"route"`
 			Limit       json.Number `json:"limit"`
-			DateTime    string      `json:"date-time"`
+			DateTime    when.Value  `json:"date-time"`
 			Query       string      `json:"query"`
+			Place       string      `json:"place"`
+			SourcePlace string      `json:"source-place"`
+			Name        string      `json:"name"`
+			TimePeriod  string      `json:"time-period"`
+			Window      string      `json:"window"`
+			Time        string      `json:"time"`
+			Days        []string    `json:"days"`
+			Delay       json.Number `json:"delay"`
+			Station     string      `json:"station"`
+			Ordinal     json.Number `json:"ordinal"`
+			Choice      string      `json:"choice"`
+			Options     []string    `json:"options"`
+			Trip        string      `json:"trip"`
+			StepFree    string      `json:"step-free"`
+			Crowding    string      `json:"crowding"`
+			Discount    string      `json:"discount"`
 		} `json:"parameters"`
 		Contexts []interface{} `json:"contexts"`
 		Metadata struct {
@@ -62,6 +81,18 @@ type DialogflowRequest struct {
 					City             string `json:"city"`
 				} `json:"location"`
 			} `json:"device"`
+			Surface struct {
+				Capabilities []struct {
+					Name string `json:"name"`
+				} `json:"capabilities"`
+			} `json:"surface"`
+			Inputs []struct {
+				Intent    string `json:"intent"`
+				Arguments []struct {
+					Name      string `json:"name"`
+					TextValue string `json:"textValue"`
+				} `json:"arguments"`
+			} `json:"inputs"`
 		} `json:"data"`
 	} `json:"originalRequest"`
 	Status struct {
@@ -76,18 +107,91 @@ type DialogflowRequest struct {
 type DialogflowResponse_Data_Google_SystemIntent struct {
 	Intent string `json:"intent,omitempty"`
 	Data   struct {
-		Type        string   `json:"@type,omitempty"`
-		OptContext  string   `json:"opt_context,omitempty"`
-		Permissions []string `json:"permissions,omitempty"`
+		Type        string                                     `json:"@type,omitempty"`
+		OptContext  string                                     `json:"opt_context,omitempty"`
+		Permissions []string                                   `json:"permissions,omitempty"`
+		ListSelect  *DialogflowResponse_Data_Google_ListSelect `json:"listSelect,omitempty"`
 	} `json:"data,omitempty"`
 }
 
+type DialogflowResponse_Data_Google_ListSelect struct {
+	Title string                                      `json:"title,omitempty"`
+	Items []DialogflowResponse_Data_Google_OptionItem `json:"items"`
+}
+
+type DialogflowResponse_Data_Google_OptionItem struct {
+	OptionInfo struct {
+		Key      string   `json:"key"`
+		Synonyms []string `json:"synonyms,omitempty"`
+	} `json:"optionInfo"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
 type DialogflowResponse_Data_Google struct {
 	ExpectUserResponse bool                                         `json:"expectUserResponse,omitempty"`
 	ExpectedInputs     []*DialogflowResponse_Data_Google            `json:"expectedInputs,omitempty"`
-	IsSsml             bool                                         `json:"isSsmp,omitempty"`
+	IsSsml             bool                                         `json:"isSsml,omitempty"`
 	NoInputPrompts     []interface{}                                `json:"noInputPrompts,omitempty"`
 	SystemIntent       *DialogflowResponse_Data_Google_SystemIntent `json:"systemIntent,omitempty"`
+	RichResponse       *DialogflowResponse_Data_Google_RichResponse `json:"richResponse,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_RichResponse struct {
+	Items       []DialogflowResponse_Data_Google_Item       `json:"items"`
+	Suggestions []DialogflowResponse_Data_Google_Suggestion `json:"suggestions,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_Item struct {
+	SimpleResponse *DialogflowResponse_Data_Google_SimpleResponse `json:"simpleResponse,omitempty"`
+	BasicCard      *DialogflowResponse_Data_Google_BasicCard      `json:"basicCard,omitempty"`
+	TableCard      *DialogflowResponse_Data_Google_TableCard      `json:"tableCard,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_SimpleResponse struct {
+	TextToSpeech string `json:"textToSpeech,omitempty"`
+	Ssml         string `json:"ssml,omitempty"`
+	DisplayText  string `json:"displayText,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_Button struct {
+	Title         string `json:"title"`
+	OpenURLAction struct {
+		URL string `json:"url"`
+	} `json:"openUrlAction"`
+}
+
+type DialogflowResponse_Data_Google_BasicCard struct {
+	Title         string                                  `json:"title,omitempty"`
+	Subtitle      string                                  `json:"subtitle,omitempty"`
+	FormattedText string                                  `json:"formattedText,omitempty"`
+	Buttons       []DialogflowResponse_Data_Google_Button `json:"buttons,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_TableCard struct {
+	Title            string                                            `json:"title,omitempty"`
+	Subtitle         string                                            `json:"subtitle,omitempty"`
+	ColumnProperties []DialogflowResponse_Data_Google_TableCard_Column `json:"columnProperties"`
+	Rows             []DialogflowResponse_Data_Google_TableCard_Row    `json:"rows"`
+	Buttons          []DialogflowResponse_Data_Google_Button           `json:"buttons,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_TableCard_Column struct {
+	Header              string `json:"header"`
+	HorizontalAlignment string `json:"horizontalAlignment,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_TableCard_Row struct {
+	Cells        []DialogflowResponse_Data_Google_TableCard_Cell `json:"cells"`
+	DividerAfter bool                                            `json:"dividerAfter,omitempty"`
+}
+
+type DialogflowResponse_Data_Google_TableCard_Cell struct {
+	Text string `json:"text"`
+}
+
+type DialogflowResponse_Data_Google_Suggestion struct {
+	Title string `json:"title"`
 }
 
 type DialogflowResponse_Data struct {
@@ -95,13 +199,14 @@ type DialogflowResponse_Data struct {
 }
 
 type DialogflowResponse struct {
-	Speech        string                   `json:"speech,omitempty"`
-	DisplaySpeech string                   `json:"displayText,omitempty"`
-	Data          *DialogflowResponse_Data `json:"data,omitempty"`
-	ContextOut    []struct {
-		Name       string `json:"name,omitempty"`
-		Lifespan   int    `json:"lifespan,omitempty"`
-		Parameters struct {
-		} `json:"parameters,omitempty"`
-	} `json:"contextOut,omitempty"`
+	Speech        string                       `json:"speech,omitempty"`
+	DisplaySpeech string                       `json:"displayText,omitempty"`
+	Data          *DialogflowResponse_Data     `json:"data,omitempty"`
+	ContextOut    []DialogflowResponse_Context `json:"contextOut,omitempty"`
+}
+
+type DialogflowResponse_Context struct {
+	Name       string                 `json:"name,omitempty"`
+	Lifespan   int                    `json:"lifespan,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
 }
@@ -0,0 +1,137 @@
+// Command gazetteer generates the Dialogflow sbb_stops entity and the
+// webhook's station index from the SBB DiDok export, e.g.
+// https://data.sbb.ch/explore/dataset/dienststellen-gemass-opentransportdataswiss/
+//
+//	gazetteer --input didok.csv --entities Dialogflow/entities --index stations.json \
+//	    --no_busses_except_for "Zürich,Basel,Bern,Luzern,Winterthur,Locarno,Lugano,Genèv,Laus,Gallen,Biel,Thun,Fribo,Köniz,Chaux,Schaffha,Vernier,Chur,Neuch,Uster"
+//
+// It replaces autoparse.py.
+//
+// It also generates the routes entity from the routes.txt of the Swiss GTFS
+// feed, https://opentransportdata.swiss/en/dataset/timetable-2018-gtfs:
+//
+//	gazetteer --routes gtfs/routes.txt --entities Dialogflow/entities
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gazetteer"
+	"lines"
+)
+
+func split(s string) []string {
+	r := []string{}
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			r = append(r, x)
+		}
+	}
+	return r
+}
+
+func main() {
+	input := flag.String("input", "", "DiDok CSV export to read, if any")
+	routes := flag.String("routes", "", "GTFS routes.txt to read, if any")
+	entities := flag.String("entities", "", "directory to write sbb_stops_entries_LANG.json and routes_entries_LANG.json to, if any")
+	index := flag.String("index", "", "file to write the station index to, if any")
+	langs := flag.String("langs", "en,de", "languages to generate entities for")
+	operators := flag.String("allowed_bus_operators", "", "only keep stops of these operators, e.g. SBB,VBZ")
+	agencies := flag.String("agencies", "", "only keep routes of these GTFS agency IDs")
+	busCities := flag.String("no_busses_except_for", "", "drop stops without trains, unless their name contains one of these")
+	flag.Parse()
+	if *input == "" && *routes == "" {
+		fmt.Fprintln(os.Stderr, "gazetteer: --input or --routes is required")
+		os.Exit(2)
+	}
+	if *routes != "" {
+		if err := runRoutes(*routes, *entities, split(*langs), split(*agencies)); err != nil {
+			fmt.Fprintf(os.Stderr, "gazetteer: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *input == "" {
+		return
+	}
+	if err := run(*input, *entities, *index, split(*langs), gazetteer.Options{
+		Operators: split(*operators),
+		BusCities: split(*busCities),
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "gazetteer: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(input, entities, index string, langs []string, opts gazetteer.Options) error {
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stations, err := gazetteer.Parse(f, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", input, err)
+	}
+	fmt.Println("Processed", len(stations), "stops")
+
+	if entities != "" {
+		for _, lang := range langs {
+			path := filepath.Join(entities, "sbb_stops_entries_"+lang+".json")
+			if err := writeEntities(path, gazetteer.Entities(gazetteer.Expand(stations, lang))); err != nil {
+				return err
+			}
+		}
+	}
+	if index != "" {
+		if err := gazetteer.Save(index, gazetteer.Expand(stations, langs...)); err != nil {
+			return err
+		}
+		fmt.Println("Wrote the index to", index)
+	}
+	return nil
+}
+
+func runRoutes(input, entities string, langs, agencies []string) error {
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	routes, err := lines.ParseRoutes(f, agencies...)
+	if err != nil {
+		return fmt.Errorf("%s: %v", input, err)
+	}
+	fmt.Println("Processed", len(routes), "routes")
+	if entities == "" {
+		return nil
+	}
+	for _, lang := range langs {
+		path := filepath.Join(entities, "routes_entries_"+lang+".json")
+		if err := writeEntities(path, lines.Entities(routes, lang)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEntities(path string, es []gazetteer.Entity) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(es); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", len(es), "entries to", path)
+	return nil
+}
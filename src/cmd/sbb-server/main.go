@@ -0,0 +1,156 @@
+// Command sbb-server runs the Dialogflow webhook and the JSON API as a plain
+// net/http server, without App Engine, e.g. in a container or locally.
+//
+//	sbb-server --port 8080 --static src/app/static --config config.json:config.local.json --users users.json
+//
+// It also answers health checks at /healthz. See package config for the
+// configuration files and environment variables.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"alerts"
+	"app"
+	"config"
+	"localize"
+	"users"
+)
+
+func main() {
+	port := flag.String("port", os.Getenv("PORT"), "port to listen on (default $PORT, or 8080)")
+	data := flag.String("data", "", "directory with the localize translation files (default ./data)")
+	static := flag.String("static", "", "directory with the privacy policies and openapi.yaml, if they should be served")
+	configFiles := flag.String("config", os.Getenv("SBB_CONFIG"), "config files, separated like $PATH, applied in order (default $SBB_CONFIG)")
+	grace := flag.Duration("grace", 10*time.Second, "how long to wait for in-flight requests on shutdown")
+	usersFile := flag.String("users", "", "JSON file to keep favorites and places in (default: forget them on exit)")
+	flag.Parse()
+	if *port == "" {
+		*port = "8080"
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if *data != "" {
+		if err := localize.LoadTranslations(*data); err != nil {
+			logger.Fatalf("Error loading translations: %v", err)
+		}
+	}
+	// Without them, every request would panic.
+	if err := localize.Loaded(); err != nil {
+		logger.Fatalf("Error loading translations: %v; run from a directory with ./data or give --data", err)
+	}
+
+	cfg, err := config.Load(config.Files(*configFiles)...)
+	if err != nil {
+		logger.Fatalf("Error loading config: %v", err)
+	}
+
+	// The handler and the alerts checker must share the store.
+	var store users.Store = users.NewMemory()
+	if *usersFile != "" {
+		if store, err = users.OpenFile(*usersFile); err != nil {
+			logger.Fatalf("Error loading users: %v", err)
+		}
+	}
+
+	client := &http.Client{Timeout: time.Duration(cfg.Timeout)}
+	env := app.Env{
+		Client: func(context.Context) *http.Client { return client },
+		Infof:  func(_ context.Context, f string, xs ...interface{}) { logger.Printf("INFO: "+f, xs...) },
+		Errorf: func(_ context.Context, f string, xs ...interface{}) { logger.Printf("ERROR: "+f, xs...) },
+		Config: &cfg,
+		Users:  store,
+	}
+	h, err := app.NewHandler(env)
+	if err != nil {
+		logger.Fatalf("Error creating handler: %v", err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if cfg.Enabled(config.FeatureAlerts) {
+		checker, err := app.NewChecker(env)
+		if err != nil {
+			logger.Fatalf("Error creating alerts checker: %v", err)
+		}
+		go alerts.Run(ctx, checker, time.Duration(cfg.Alerts.Interval), logger.Printf)
+	}
+	srv := &http.Server{
+		Addr:     ":" + *port,
+		Handler:  newMux(h, *static),
+		ErrorLog: logger,
+	}
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		sig := <-sigs
+		logger.Printf("Received %v, shutting down", sig)
+		stop()
+	}()
+
+	l, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sbb-server: %v\n", err)
+		os.Exit(1)
+	}
+	logger.Printf("Listening on %s", srv.Addr)
+	if err := serve(ctx, srv, l, *grace); err != nil {
+		fmt.Fprintf(os.Stderr, "sbb-server: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newMux serves h, a health check for load balancers at /healthz and, if
+// static is set, the files app.yaml serves statically.
+func newMux(h http.Handler, static string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	if static != "" {
+		// Mirrors the static handlers in app.yaml.
+		for url, file := range map[string]string{
+			"/en-privacy":          "en-privacy.txt",
+			"/de-privacy":          "de-privacy.txt",
+			"/fr-privacy":          "fr-privacy.txt",
+			"/api/v1/openapi.yaml": "openapi.yaml",
+		} {
+			path := filepath.Join(static, file)
+			mux.HandleFunc(url, func(w http.ResponseWriter, r *http.Request) {
+				http.ServeFile(w, r, path)
+			})
+		}
+	}
+	return mux
+}
+
+// serve runs srv on l until ctx is done, then waits up to grace for
+// in-flight requests before returning.
+func serve(ctx context.Context, srv *http.Server, l net.Listener, grace time.Duration) error {
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Serve(l) }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-errs; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"app"
+	"localize"
+)
+
+func init() {
+	if err := localize.LoadTranslations("../../localize/data"); err != nil {
+		panic(err)
+	}
+}
+
+func TestNewMux(t *testing.T) {
+	h, err := app.NewHandler(app.Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newMux(h, "../../app/static"))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+		want               string
+	}{
+		{"GET", "/healthz", "", http.StatusOK, "ok"},
+		// The trip follow-up without a trip doesn't need the timetable API.
+		{"POST", "/dialogflow", `{"lang": "en", "result": {"metadata": {"intentName": "trip-position"}}}`, http.StatusOK, `"speech"`},
+		{"GET", "/api/v1/departures", "", http.StatusBadRequest, "Either station or lat and lon are required"},
+		{"GET", "/api/v1/openapi.yaml", "", http.StatusOK, "openapi:"},
+		{"GET", "/en-privacy", "", http.StatusOK, ""},
+		{"GET", "/debug/config", "", http.StatusNotFound, ""},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || !strings.Contains(string(bs), tc.want) {
+			t.Errorf("%v %v: want %v with %q, got %v: %s", tc.method, tc.path, tc.status, tc.want, resp.StatusCode, bs)
+		}
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, srv, l, 5*time.Second) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		bs, _ := ioutil.ReadAll(resp.Body)
+		body <- string(bs)
+	}()
+	<-started
+	stop()
+
+	// The request in flight is finished before serve returns.
+	if err := <-served; err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+	if got := <-body; got != "done" {
+		t.Errorf("want the in-flight request answered, got %q", got)
+	}
+	if _, err := http.Get("http://" + l.Addr().String()); err == nil {
+		t.Error("want new requests refused after shutdown")
+	}
+}
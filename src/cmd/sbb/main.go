@@ -0,0 +1,336 @@
+// Command sbb queries departures, connections and nearby stations from the
+// command line, using the same logic as the assistant.
+//
+// Usage:
+//
+//	sbb dep "Zürich HB" --mode tram --route 4 --limit 5
+//	sbb conn Bern Basel --at 08:00 --arrive
+//	sbb dep Bern --at "tomorrow morning"
+//	sbb near 47.37,8.54
+//
+// Output is a table by default; --output json prints JSON, and --output text
+// prints what the assistant would say, in the language given by --lang.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"config"
+	"localize"
+	"query"
+	"transport"
+	"when"
+)
+
+const usage = `Usage:
+  sbb dep STATION [flags]
+  sbb conn FROM TO [flags]
+  sbb near LAT,LON [flags]
+
+Flags:
+`
+
+// listFlag is a flag that may be repeated or given comma-separated values.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	for _, x := range strings.Split(v, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			*l = append(*l, x)
+		}
+	}
+	return nil
+}
+
+type options struct {
+	modes   listFlag
+	routes  listFlag
+	limit   int
+	at      string
+	arrive  bool
+	lang    string
+	output  string
+	data    string
+	config  string
+	verbose bool
+}
+
+// defaultDataDir looks for the translations in the GOPATH.
+func defaultDataDir() string {
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		dir := filepath.Join(p, "src", "localize", "data")
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return "./data"
+}
+
+func newFlagSet(opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("sbb", flag.ContinueOnError)
+	fs.Var(&opts.modes, "mode", "only show these modes, e.g. tram (repeatable)")
+	fs.Var(&opts.routes, "route", "only show these lines, e.g. S12 (repeatable)")
+	fs.IntVar(&opts.limit, "limit", 0, "number of results (default from config)")
+	fs.StringVar(&opts.at, "at", "", "time, as 15:04, \"2006-01-02 15:04\", RFC 3339 or e.g. \"tomorrow at 8\" (default now)")
+	fs.BoolVar(&opts.arrive, "arrive", false, "for conn, treat --at as the arrival time")
+	fs.StringVar(&opts.lang, "lang", "en", "language for text output")
+	fs.StringVar(&opts.output, "output", "table", "output format: table, json or text")
+	fs.StringVar(&opts.data, "data", defaultDataDir(), "directory with the localize translation files")
+	fs.StringVar(&opts.config, "config", os.Getenv("SBB_CONFIG"), "config files, separated like $PATH (default $SBB_CONFIG)")
+	fs.BoolVar(&opts.verbose, "v", false, "log request URLs to stderr")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses flags interspersed with positional arguments, which the flag
+// package does not do by itself.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	pos := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// parseTime resolves --at, which may also be relative, e.g. "in 20 minutes"
+// or "tomorrow morning".
+func parseTime(raw string, tz *time.Location) (time.Time, error) {
+	r, err := when.Resolver{Location: tz}.Resolve(raw)
+	if err != nil || r.IsZero() {
+		return time.Time{}, err
+	}
+	return r.From(time.Now().In(tz)), nil
+}
+
+func parseLatLon(raw string) (float64, float64, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid coordinates %q: want LAT,LON", raw)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude %q", parts[0])
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude %q", parts[1])
+	}
+	return lat, lon, nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "sbb: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args, printing its results to out.
+func run(args []string, out io.Writer) error {
+	opts := options{}
+	fs := newFlagSet(&opts)
+	pos, err := parse(fs, args)
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing command")
+	}
+	switch opts.output {
+	case "table", "json", "text":
+	default:
+		return fmt.Errorf("unknown output format %q", opts.output)
+	}
+	// Tables name modes in --lang too.
+	if err := localize.LoadTranslations(opts.data); err != nil {
+		return fmt.Errorf("loading translations: %v", err)
+	}
+
+	cfg, err := config.Load(config.Files(opts.config)...)
+	if err != nil {
+		return err
+	}
+	tz, err := cfg.Location()
+	if err != nil {
+		return err
+	}
+	svc := transport.Transport{
+		Client: &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		Endpoints: transport.Endpoints{
+			Stationboard: cfg.Endpoints.Stationboard,
+			Connections:  cfg.Endpoints.Connections,
+			Locations:    cfg.Endpoints.Locations,
+			Occupancy:    cfg.Endpoints.Occupancy,
+			Trip:         cfg.Endpoints.Trip,
+		},
+	}
+	if opts.verbose {
+		svc.Logger = func(x string) { fmt.Fprintln(os.Stderr, x) }
+	}
+	p := query.Params{
+		Transport: opts.modes,
+		Route:     opts.routes,
+		Limit:     opts.limit,
+		ArriveBy:  opts.arrive,
+
+		IgnoredIconClasses: cfg.IgnoredIconClasses,
+	}
+	if p.Limit == 0 {
+		p.Limit = cfg.Limits.Departures
+	}
+	if p.Datetime, err = parseTime(opts.at, tz); err != nil {
+		return err
+	}
+	loc := localize.NewLocalizer(opts.lang, tz)
+
+	cmd, pos := pos[0], pos[1:]
+	switch cmd {
+	case "dep", "departures":
+		if len(pos) != 1 {
+			return fmt.Errorf("usage: sbb dep STATION")
+		}
+		p.Source = pos[0]
+		deps, err := query.Stationboard(svc, p, tz)
+		if err != nil {
+			return err
+		}
+		return printDepartures(out, opts.output, loc, p, deps)
+	case "conn", "connections":
+		if len(pos) != 2 {
+			return fmt.Errorf("usage: sbb conn FROM TO")
+		}
+		p.Source, p.Destination = pos[0], pos[1]
+		conns, err := query.Connections(svc, p, tz)
+		if err != nil {
+			return err
+		}
+		return printConnections(out, opts.output, loc, p, conns)
+	case "near", "nearby":
+		if len(pos) != 1 {
+			return fmt.Errorf("usage: sbb near LAT,LON")
+		}
+		if p.Lat, p.Lon, err = parseLatLon(pos[0]); err != nil {
+			return err
+		}
+		limit := opts.limit
+		if limit == 0 {
+			limit = cfg.Limits.Stations
+		}
+		stats, err := query.Stations(svc, p, limit)
+		if err != nil {
+			return err
+		}
+		return printStations(out, opts.output, loc, stats)
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func delay(d localize.Departure) string {
+	if d.MinutesDelay < 1 {
+		return ""
+	}
+	return fmt.Sprintf("+%d", d.MinutesDelay)
+}
+
+func platform(d localize.Departure) string {
+	if d.PlatformChanged && d.Platform != "" {
+		return d.Platform + "!"
+	}
+	return d.Platform
+}
+
+func printDepartures(out io.Writer, output string, loc localize.Localizer, p query.Params, deps []localize.Departure) error {
+	switch output {
+	case "json":
+		return printJSON(out, deps)
+	case "text":
+		fmt.Fprintln(out, loc.NextDepartures(p.Source, "", p.Datetime, deps))
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tDELAY\tLINE\tMODE\tTO\tPLATFORM")
+	for _, d := range deps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.Departing.Format("15:04"), delay(d), d.Name, loc.Mode(d.Mode, 1), d.To, platform(d))
+	}
+	return w.Flush()
+}
+
+func printConnections(out io.Writer, output string, loc localize.Localizer, p query.Params, conns []query.Connection) error {
+	switch output {
+	case "json":
+		return printJSON(out, conns)
+	case "text":
+		deps := []localize.Departure{}
+		for _, c := range conns {
+			deps = append(deps, c.Departure())
+		}
+		fmt.Fprintln(out, loc.NextDepartures(p.Source, p.Destination, p.Datetime, deps))
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPART\tARRIVE\tDELAY\tLINE\tFROM\tTO\tPLATFORM")
+	for _, c := range conns {
+		for i, l := range c.Legs {
+			dep, arr := l.Departing.Format("15:04"), ""
+			if i == 0 {
+				arr = c.Arriving.Format("15:04")
+			} else {
+				dep = "  " + dep
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				dep, arr, delay(l), l.Name, l.From, l.To, platform(l))
+		}
+	}
+	return w.Flush()
+}
+
+func printStations(out io.Writer, output string, loc localize.Localizer, stats []localize.Station) error {
+	switch output {
+	case "json":
+		return printJSON(out, stats)
+	case "text":
+		fmt.Fprintln(out, loc.Stations("", stats))
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATION\tDISTANCE")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%dm\n", s.Name, int(s.Distance))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeConfig starts a fake timetable API and writes a config file using it.
+func fakeConfig(t *testing.T) (string, func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stationboard.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"stop": {"name": "Zürich HB"}, "connections": [
+		  {"time": "2018-03-05 12:04:00", "type": "tram", "line": "4", "terminal": {"name": "Tiefenbrunnen"}}]}`)
+	})
+	mux.HandleFunc("/route.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"connections": [{"from": "Zürich HB", "to": "Uster", "departure": "2018-03-05 12:04:00", "arrival": "2018-03-05 12:19:00",
+		  "legs": [{"departure": "2018-03-05 12:04:00", "sbb_name": "Zürich HB", "type": "strain", "line": "S5", "exit": {"sbb_name": "Uster"}}]}]}`)
+	})
+	mux.HandleFunc("/completion.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"label": "Zürich HB", "dist": 80, "iconclass": "sl-icon-type-train"}]`)
+	})
+	srv := httptest.NewServer(mux)
+	dir, err := ioutil.TempDir("", "sbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	bs, _ := json.Marshal(map[string]interface{}{"endpoints": map[string]string{
+		"stationboard": srv.URL + "/stationboard.json",
+		"connections":  srv.URL + "/route.json",
+		"locations":    srv.URL + "/completion.json",
+	}})
+	if err := ioutil.WriteFile(path, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cfg, done := fakeConfig(t)
+	defer done()
+	data := filepath.Join("..", "..", "localize", "data")
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"dep", "Zürich HB"}, "Tiefenbrunnen"},
+		{[]string{"dep", "Zürich HB", "--output", "json"}, `"Name": "4"`},
+		{[]string{"dep", "Zürich HB", "--output", "text"}, "Tiefenbrunnen"},
+		{[]string{"conn", "Zürich HB", "Uster"}, "S5"},
+		{[]string{"conn", "Zürich HB", "Uster", "--output", "json"}, `"Name": "S5"`},
+		{[]string{"conn", "Zürich HB", "Uster", "--output", "text"}, "Uster"},
+		{[]string{"near", "47.37,8.54"}, "80m"},
+		{[]string{"near", "47.37,8.54", "--output", "json"}, `"Name": "Zürich HB"`},
+		{[]string{"near", "47.37,8.54", "--output", "text", "--lang", "de"}, "Zürich HB"},
+	} {
+		out := &bytes.Buffer{}
+		args := append(tc.args, "--config", cfg, "--data", data)
+		if err := run(args, out); err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		if !strings.Contains(out.String(), tc.want) {
+			t.Errorf("%v: want %q in %q", tc.args, tc.want, out)
+		}
+	}
+
+	if err := run([]string{"dep", "Zürich HB", "--config", cfg, "--data", "no-such-dir"}, &bytes.Buffer{}); err == nil {
+		t.Error("want an error without translations, got nil")
+	}
+	if err := run([]string{"dep", "Zürich HB", "--config", cfg, "--output", "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("want an error for an unknown output format, got nil")
+	}
+}
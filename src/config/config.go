@@ -0,0 +1,348 @@
+// Package config holds the deployment configuration: timetable API
+// endpoints, defaults and feature switches.
+//
+// Configuration starts from Default(), is overridden by JSON files in order
+// (e.g. a base file, then a per-deployment one), and then by SBB_*
+// environment variables.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feature switches.
+const (
+	// FeatureAPI serves the JSON API under /api/v1.
+	FeatureAPI = "api"
+	// FeatureDebugConfig serves the effective configuration at /debug/config.
+	FeatureDebugConfig = "debug_config"
+	// FeatureSSML speaks departures with SSML pronunciation hints.
+	FeatureSSML = "ssml"
+	// FeatureAlerts checks subscribed journeys for delays and notifies
+	// users.
+	FeatureAlerts = "alerts"
+)
+
+// Duration is a time.Duration which is a string like "1m30s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(bs []byte) error {
+	var s string
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type Endpoints struct {
+	Stationboard string `json:"stationboard"`
+	Connections  string `json:"connections"`
+	Locations    string `json:"locations"`
+	// Occupancy is optional; without it, there are no occupancy
+	// forecasts.
+	Occupancy string `json:"occupancy,omitempty"`
+	// Trip is optional; without it, follow-ups about a trip aren't
+	// answered.
+	Trip string `json:"trip,omitempty"`
+}
+
+type Limits struct {
+	// Stations is the default number of nearby stations to list.
+	Stations int `json:"stations"`
+	// Departures is the default number of departures to list.
+	Departures int `json:"departures"`
+	// Max caps how many stations, departures or connections can be asked
+	// for, since more can mean more timetable API calls.
+	Max int `json:"max"`
+}
+
+type Alerts struct {
+	// Interval is how often cmd/sbb-server checks subscriptions. On App
+	// Engine, cron.yaml says.
+	Interval Duration `json:"interval"`
+	// Lookahead is how long before departure to start watching a journey.
+	Lookahead Duration `json:"lookahead"`
+	// MinDelay is the delay in minutes worth an alert, for subscriptions
+	// which don't say.
+	MinDelay int `json:"min_delay"`
+	// Webhook, if set, is the URL alerts are posted to. Otherwise they're
+	// logged.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+type Walking struct {
+	// Speed is how fast people walk to the station, in km/h.
+	Speed float64 `json:"speed"`
+	// Buffer is the time to spare when catching a departure, e.g. to find
+	// the platform.
+	Buffer Duration `json:"buffer"`
+}
+
+type Config struct {
+	Endpoints Endpoints `json:"endpoints"`
+	Limits    Limits    `json:"limits"`
+	// Timezone is the IANA name of the timezone times are spoken in.
+	Timezone string `json:"timezone"`
+	// Timeout bounds the timetable API calls made for one request.
+	Timeout Duration `json:"timeout"`
+	// IgnoredIconClasses are prefixes of location icon classes which are
+	// not stations, e.g. street addresses.
+	IgnoredIconClasses []string `json:"ignored_icon_classes"`
+	// Features are switched on or off by name.
+	Features map[string]bool `json:"features"`
+	Alerts   Alerts          `json:"alerts"`
+	Walking  Walking         `json:"walking"`
+	// Gazetteer is the station index written by cmd/gazetteer, if any.
+	Gazetteer string `json:"gazetteer"`
+	// Fares is the zone fare tables (see package fares), if any. The
+	// default is the bundled table, which deploy.sh copies next to the
+	// translations.
+	Fares string `json:"fares"`
+}
+
+// Default returns the configuration used if nothing is overridden.
+func Default() Config {
+	return Config{
+		Endpoints: Endpoints{
+			Stationboard: "https://timetable.search.ch/api/stationboard.json",
+			Connections:  "https://timetable.search.ch/api/route.json",
+			Locations:    "https://timetable.search.ch/api/completion.json",
+			Occupancy:    "https://transport.opendata.ch/v1/connections",
+			Trip:         "https://transport.opendata.ch/v1/journey",
+		},
+		Limits: Limits{
+			Stations:   3,
+			Departures: 5,
+			Max:        20,
+		},
+		Timezone:           "Europe/Zurich",
+		Timeout:            Duration(1 * time.Minute),
+		IgnoredIconClasses: []string{"sl-icon-type-adr", "sl-icon-tel"},
+		Features: map[string]bool{
+			FeatureAPI:         true,
+			FeatureDebugConfig: false,
+			FeatureSSML:        true,
+			FeatureAlerts:      false,
+		},
+		Alerts: Alerts{
+			Interval:  Duration(1 * time.Minute),
+			Lookahead: Duration(30 * time.Minute),
+			MinDelay:  3,
+		},
+		Walking: Walking{
+			Speed:  4.5,
+			Buffer: Duration(1 * time.Minute),
+		},
+		Fares: "data/fares.json",
+	}
+}
+
+// Enabled returns whether the named feature is switched on.
+func (c Config) Enabled(feature string) bool {
+	return c.Features[feature]
+}
+
+// Location returns the configured timezone.
+func (c Config) Location() (*time.Location, error) {
+	return time.LoadLocation(c.Timezone)
+}
+
+// redacted replaces the values of credential fields, which may be in URLs.
+const redacted = "REDACTED"
+
+// Redacted returns c with credentials, like the alerts webhook's URL,
+// replaced so it can be shown, e.g. at /debug/config. Fields holding
+// credentials must be added here.
+func (c Config) Redacted() Config {
+	if c.Alerts.Webhook != "" {
+		c.Alerts.Webhook = redacted
+	}
+	return c
+}
+
+// Validate returns an error describing everything wrong with c.
+func (c Config) Validate() error {
+	errs := []string{}
+	for name, e := range map[string]string{
+		"endpoints.stationboard": c.Endpoints.Stationboard,
+		"endpoints.connections":  c.Endpoints.Connections,
+		"endpoints.locations":    c.Endpoints.Locations,
+		"endpoints.occupancy":    c.Endpoints.Occupancy,
+		"endpoints.trip":         c.Endpoints.Trip,
+	} {
+		if (name == "endpoints.occupancy" || name == "endpoints.trip") && e == "" {
+			continue
+		}
+		if u, err := url.Parse(e); err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Sprintf("%s: %q is not an http(s) URL", name, e))
+		}
+	}
+	if c.Limits.Stations < 1 {
+		errs = append(errs, fmt.Sprintf("limits.stations: %d is not positive", c.Limits.Stations))
+	}
+	if c.Limits.Departures < 1 {
+		errs = append(errs, fmt.Sprintf("limits.departures: %d is not positive", c.Limits.Departures))
+	}
+	if c.Limits.Max < c.Limits.Stations || c.Limits.Max < c.Limits.Departures {
+		errs = append(errs, fmt.Sprintf("limits.max: %d is less than the defaults", c.Limits.Max))
+	}
+	if _, err := c.Location(); err != nil || c.Timezone == "" {
+		errs = append(errs, fmt.Sprintf("timezone: %q is not a known timezone", c.Timezone))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Sprintf("timeout: %v is not positive", time.Duration(c.Timeout)))
+	}
+	if c.Alerts.Interval <= 0 {
+		errs = append(errs, fmt.Sprintf("alerts.interval: %v is not positive", time.Duration(c.Alerts.Interval)))
+	}
+	if c.Alerts.MinDelay < 1 {
+		errs = append(errs, fmt.Sprintf("alerts.min_delay: %d is not positive", c.Alerts.MinDelay))
+	}
+	if c.Walking.Speed <= 0 {
+		errs = append(errs, fmt.Sprintf("walking.speed: %v is not positive", c.Walking.Speed))
+	}
+	if c.Walking.Buffer < 0 {
+		errs = append(errs, fmt.Sprintf("walking.buffer: %v is negative", time.Duration(c.Walking.Buffer)))
+	}
+	if w := c.Alerts.Webhook; w != "" {
+		if u, err := url.Parse(w); err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Sprintf("alerts.webhook: %q is not an http(s) URL", w))
+		}
+	}
+	if len(errs) > 0 {
+		// Map iteration order is random, but error messages shouldn't be.
+		sort.Strings(errs)
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Load returns the default configuration overridden by each of files in
+// order, then by the environment, and validated.
+func Load(files ...string) (Config, error) {
+	c := Default()
+	for _, f := range files {
+		bs, err := ioutil.ReadFile(f)
+		if err != nil {
+			return c, err
+		}
+		// Unmarshalling into c only replaces the fields present in the file.
+		// Features are merged rather than replaced.
+		features := c.Features
+		c.Features = nil
+		if err := json.Unmarshal(bs, &c); err != nil {
+			return c, fmt.Errorf("%s: %v", f, err)
+		}
+		for k, v := range c.Features {
+			features[k] = v
+		}
+		c.Features = features
+	}
+	if err := c.applyEnv(os.Getenv); err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+// FromEnv loads the files listed in $SBB_CONFIG (separated like $PATH), then
+// applies the environment.
+func FromEnv() (Config, error) {
+	return Load(Files(os.Getenv("SBB_CONFIG"))...)
+}
+
+// Files splits a list of config files separated like $PATH.
+func Files(list string) []string {
+	files := []string{}
+	for _, f := range filepath.SplitList(list) {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// applyEnv overrides c with the SBB_* environment variables:
+//
+//	SBB_STATIONBOARD_ENDPOINT, SBB_CONNECTIONS_ENDPOINT, SBB_LOCATIONS_ENDPOINT
+//	SBB_OCCUPANCY_ENDPOINT, SBB_TRIP_ENDPOINT
+//	SBB_STATIONS_LIMIT, SBB_DEPARTURES_LIMIT, SBB_MAX_LIMIT
+//	SBB_TIMEZONE, SBB_TIMEOUT (e.g. "30s")
+//	SBB_ALERTS_WEBHOOK
+//	SBB_GAZETTEER, SBB_FARES
+//	SBB_IGNORED_ICON_CLASSES (comma-separated)
+//	SBB_FEATURES (comma-separated; "name" or "name=true" switches on, "name=false" off)
+func (c *Config) applyEnv(getenv func(string) string) error {
+	for k, p := range map[string]*string{
+		"SBB_STATIONBOARD_ENDPOINT": &c.Endpoints.Stationboard,
+		"SBB_CONNECTIONS_ENDPOINT":  &c.Endpoints.Connections,
+		"SBB_LOCATIONS_ENDPOINT":    &c.Endpoints.Locations,
+		"SBB_OCCUPANCY_ENDPOINT":    &c.Endpoints.Occupancy,
+		"SBB_TRIP_ENDPOINT":         &c.Endpoints.Trip,
+		"SBB_TIMEZONE":              &c.Timezone,
+		"SBB_ALERTS_WEBHOOK":        &c.Alerts.Webhook,
+		"SBB_GAZETTEER":             &c.Gazetteer,
+		"SBB_FARES":                 &c.Fares,
+	} {
+		if v := getenv(k); v != "" {
+			*p = v
+		}
+	}
+	for k, p := range map[string]*int{
+		"SBB_STATIONS_LIMIT":   &c.Limits.Stations,
+		"SBB_DEPARTURES_LIMIT": &c.Limits.Departures,
+		"SBB_MAX_LIMIT":        &c.Limits.Max,
+	} {
+		if v := getenv(k); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+			*p = i
+		}
+	}
+	if v := getenv("SBB_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("SBB_TIMEOUT: %v", err)
+		}
+		c.Timeout = Duration(d)
+	}
+	if v := getenv("SBB_IGNORED_ICON_CLASSES"); v != "" {
+		c.IgnoredIconClasses = strings.Split(v, ",")
+	}
+	if v := getenv("SBB_FEATURES"); v != "" {
+		if c.Features == nil {
+			c.Features = map[string]bool{}
+		}
+		for _, f := range strings.Split(v, ",") {
+			name, on := strings.TrimSpace(f), true
+			if i := strings.Index(name, "="); i >= 0 {
+				b, err := strconv.ParseBool(name[i+1:])
+				if err != nil {
+					return fmt.Errorf("SBB_FEATURES: %q: %v", f, err)
+				}
+				name, on = name[:i], b
+			}
+			c.Features[name] = on
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("want nil, got '%v'", err)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "config.json")
+	prod := filepath.Join(dir, "config.prod.json")
+	if err := ioutil.WriteFile(base, []byte(`{"limits": {"stations": 4, "departures": 6}, "timeout": "30s"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(prod, []byte(`{"limits": {"departures": 7}, "features": {"debug_config": true}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(base, prod)
+	if err != nil {
+		t.Fatalf("want nil, got '%v'", err)
+	}
+	if c.Limits.Stations != 4 || c.Limits.Departures != 7 {
+		t.Errorf("want limits {4 7}, got %v", c.Limits)
+	}
+	if time.Duration(c.Timeout) != 30*time.Second {
+		t.Errorf("want timeout 30s, got %v", time.Duration(c.Timeout))
+	}
+	if !c.Enabled(FeatureDebugConfig) || !c.Enabled(FeatureAPI) {
+		t.Errorf("want features merged, got %v", c.Features)
+	}
+	if c.Timezone != "Europe/Zurich" {
+		t.Errorf("want default timezone, got '%v'", c.Timezone)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"SBB_LOCATIONS_ENDPOINT": "http://localhost:8000/completion.json",
+		"SBB_DEPARTURES_LIMIT":   "10",
+		"SBB_TIMEOUT":            "5s",
+		"SBB_FEATURES":           "api=false,debug_config",
+	}
+	c := Default()
+	if err := c.applyEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatalf("want nil, got '%v'", err)
+	}
+	if c.Endpoints.Locations != env["SBB_LOCATIONS_ENDPOINT"] {
+		t.Errorf("want '%v', got '%v'", env["SBB_LOCATIONS_ENDPOINT"], c.Endpoints.Locations)
+	}
+	if c.Limits.Departures != 10 {
+		t.Errorf("want 10, got %v", c.Limits.Departures)
+	}
+	if time.Duration(c.Timeout) != 5*time.Second {
+		t.Errorf("want 5s, got %v", time.Duration(c.Timeout))
+	}
+	if c.Enabled(FeatureAPI) || !c.Enabled(FeatureDebugConfig) {
+		t.Errorf("want api off and debug_config on, got %v", c.Features)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Endpoints.Stationboard = "/relative"
+	c.Endpoints.Occupancy = "ftp://example.com/connections"
+	c.Endpoints.Trip = "journey"
+	c.Limits.Departures = 0
+	c.Limits.Max = 2
+	c.Timezone = "Mars/Olympus_Mons"
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	for _, want := range []string{"endpoints.stationboard", "endpoints.occupancy", "endpoints.trip", "limits.departures", "limits.max", "timezone"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want '%v' in '%v'", want, err)
+		}
+	}
+	if err := Default().Validate(); err != nil {
+		t.Errorf("want the defaults to be valid, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Alerts.Webhook = "https://hooks.example.com/services/T000/B000/secret"
+	if got := c.Redacted().Alerts.Webhook; strings.Contains(got, "secret") {
+		t.Errorf("want the webhook redacted, got '%v'", got)
+	}
+	if c.Alerts.Webhook == redacted {
+		t.Errorf("want c unchanged")
+	}
+	if got := Default().Redacted().Alerts.Webhook; got != "" {
+		t.Errorf("want no webhook to stay empty, got '%v'", got)
+	}
+}
@@ -0,0 +1,168 @@
+// Package fares estimates ticket prices from the zone tables of tariff
+// networks like ZVV, for connections the timetable provider doesn't give
+// a price for. search.ch doesn't give any, and there's no national table,
+// so trips which aren't within one network have no price.
+//
+// The tables are JSON files; data/fares.json has ZVV's. They need updating
+// when the networks change their prices, usually each December.
+package fares
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"gazetteer"
+)
+
+// A Network is a tariff network's zones and prices.
+type Network struct {
+	Name string `json:"name"`
+	// Stations are the zones of each station, by name. Stations on a zone
+	// border are in all of them.
+	Stations map[string][]string `json:"stations"`
+	// Towns are the zones of the stations not in Stations, by the start
+	// of their names, e.g. "Zürich" for "Zürich, Bellevue".
+	Towns map[string][]string `json:"towns,omitempty"`
+	// Double are zones which count as two, e.g. ZVV's city zones.
+	Double []string `json:"double,omitempty"`
+	// Prices are by the number of zones counted, from one. The last is for
+	// that many zones or more.
+	Prices []Price `json:"prices"`
+}
+
+// A Price is a 2nd class single ticket's price in CHF.
+type Price struct {
+	Full float64 `json:"full"`
+	// Half is with a half-fare card (Halbtax).
+	Half float64 `json:"half"`
+}
+
+// A Quote is the price of a trip in a network.
+type Quote struct {
+	Network string
+	Zones   int
+	Price
+}
+
+// Tariffs finds the network a trip is in.
+type Tariffs struct {
+	networks []Network
+	// byName and byTown are the zones of each network's stations and
+	// towns, by normalized name.
+	byName []map[string][]string
+	byTown []map[string][]string
+}
+
+// NewTariffs indexes networks. If a trip is in more than one, the first
+// wins.
+func NewTariffs(networks []Network) *Tariffs {
+	t := &Tariffs{networks: networks}
+	for _, n := range networks {
+		t.byName = append(t.byName, normalized(n.Stations))
+		t.byTown = append(t.byTown, normalized(n.Towns))
+	}
+	return t
+}
+
+func normalized(zones map[string][]string) map[string][]string {
+	m := map[string][]string{}
+	for name, zs := range zones {
+		m[gazetteer.Normalize(name)] = zs
+	}
+	return m
+}
+
+// Load reads tariffs from a JSON list of networks.
+func Load(path string) (*Tariffs, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	networks := []Network{}
+	if err := json.Unmarshal(bs, &networks); err != nil {
+		return nil, err
+	}
+	return NewTariffs(networks), nil
+}
+
+// Quote prices a trip through stops, which must all be in one network. It
+// returns false if they aren't.
+func (t *Tariffs) Quote(stops []string) (Quote, bool) {
+	for i, n := range t.networks {
+		if zones, ok := t.zones(i, stops); ok && len(n.Prices) > 0 {
+			count := 0
+			for _, z := range zones {
+				count++
+				if contains(n.Double, z) {
+					count++
+				}
+			}
+			p := n.Prices[len(n.Prices)-1]
+			if count <= len(n.Prices) {
+				p = n.Prices[count-1]
+			}
+			return Quote{Network: n.Name, Zones: count, Price: p}, true
+		}
+	}
+	return Quote{}, false
+}
+
+// zones returns the zones a trip through stops passes, counting a border
+// stop as in a zone the trip passes anyway if it can.
+func (t *Tariffs) zones(network int, stops []string) ([]string, bool) {
+	if len(stops) == 0 {
+		return nil, false
+	}
+	all := [][]string{}
+	for _, s := range stops {
+		zs := t.stationZones(network, s)
+		if len(zs) == 0 {
+			return nil, false
+		}
+		all = append(all, zs)
+	}
+	r := []string{}
+	for _, zs := range all {
+		if len(zs) == 1 && !contains(r, zs[0]) {
+			r = append(r, zs[0])
+		}
+	}
+	for _, zs := range all {
+		found := false
+		for _, z := range zs {
+			found = found || contains(r, z)
+		}
+		if !found {
+			r = append(r, zs[0])
+		}
+	}
+	return r, true
+}
+
+// stationZones returns the zones of station in network, if it's in it.
+func (t *Tariffs) stationZones(network int, station string) []string {
+	name := gazetteer.Normalize(station)
+	if zs, ok := t.byName[network][name]; ok {
+		return zs
+	}
+	// The longest town wins, so "Zürich Flughafen" can be in another zone
+	// than "Zürich".
+	var zones []string
+	longest := 0
+	for town, zs := range t.byTown[network] {
+		if (name == town || strings.HasPrefix(name, town+" ")) && len(town) > longest {
+			zones, longest = zs, len(town)
+		}
+	}
+	return zones
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package fares
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tariffs, err := Load("data/fares.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		stops []string
+		zones int
+		full  float64
+		ok    bool
+	}{
+		// The city zone counts as two.
+		{[]string{"Zürich HB", "Zürich Stadelhofen"}, 2, 4.60, true},
+		{[]string{"zuerich hb", "Zürich Stadelhofen", "Zürich Stettbach", "Dübendorf", "Uster"}, 4, 9.20, true},
+		// Stettbach is on the border, so it's in the zone the trip is in.
+		{[]string{"Dübendorf", "Zürich Stettbach"}, 1, 4.60, true},
+		{[]string{"Zürich HB", "Zürich Oerlikon", "Zürich Flughafen", "Effretikon", "Winterthur"}, 6, 13.40, true},
+		// Stops are in their town's zone, unless a longer name says
+		// otherwise.
+		{[]string{"Zürich, Bellevue", "Zürich, Rehalp"}, 2, 4.60, true},
+		{[]string{"Zürich Flughafen, Fracht", "Kloten, Stadthaus"}, 1, 4.60, true},
+		{[]string{"Winterthur, Hauptbahnhof", "Winterthur Seen"}, 2, 4.60, true},
+		{[]string{"Zürich HB", "Bern"}, 0, 0, false},
+		{nil, 0, 0, false},
+	} {
+		q, ok := tariffs.Quote(tc.stops)
+		if ok != tc.ok || q.Zones != tc.zones || q.Full != tc.full {
+			t.Errorf("%v: want %v zones for CHF %.2f (%v), got %+v (%v)", tc.stops, tc.zones, tc.full, tc.ok, q, ok)
+		}
+	}
+}
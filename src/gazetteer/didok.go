@@ -0,0 +1,198 @@
+package gazetteer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"modes"
+)
+
+// Options filters the stops read from DiDok.
+type Options struct {
+	// Operators, if set, are the only operators whose stops are kept, by
+	// abbreviation, e.g. "SBB" or "VBZ".
+	Operators []string
+	// BusCities, if set, drops stops without trains unless their name
+	// contains one of these, e.g. "Zürich". Otherwise there are far too
+	// many bus stops for Dialogflow.
+	BusCities []string
+}
+
+// columns are the names of each field in the DiDok exports we know: the
+// 2018 station-didok export, and the later service points export.
+var columns = map[string][]string{
+	"uic":      {"Dst-Nr85", "didok85", "number", "UIC", "uic"},
+	"name":     {"Dst-Bezeichnung-offiziell", "designationOfficial", "bezeichnung_offiziell", "name"},
+	"type":     {"Dst-Typ", "stopPoint", "type"},
+	"modes":    {"Verkehrsmittel", "meansOfTransport", "means_of_transport"},
+	"operator": {"GO-Abk", "businessOrganisationAbbreviationDe", "operator"},
+	"lat":      {"N-WGS84", "wgs84North", "lat"},
+	"lon":      {"E-WGS84", "wgs84East", "lon"},
+	"geopos":   {"Geoposition", "geopos"},
+}
+
+// legacyColumns are the positions autoparse.py used, for exports without a
+// header row.
+var legacyColumns = map[string]int{"uic": 0, "name": 2, "operator": 6, "type": 7, "modes": 8}
+
+// stopTypes are the values of the type column for places where passengers
+// board. The service points export has "true" instead.
+var stopTypes = map[string]bool{
+	"Haltestelle":                 true,
+	"Haltestelle_und_Bedienpunkt": true,
+	"true":                        true,
+}
+
+// meansOfTransport maps DiDok's means of transport to modes.
+var meansOfTransport = map[string]modes.Mode{
+	"zug": modes.Train, "train": modes.Train, "zahnradbahn": modes.Train, "rack_railway": modes.Train,
+	"metro": modes.Metro, "bus": modes.Bus, "tram": modes.Tram,
+	"schiff": modes.Ship, "boat": modes.Ship, "ship": modes.Ship,
+	"standseilbahn": modes.Funicular, "cable_railway": modes.Funicular,
+	"seilbahn": modes.Cableway, "luftseilbahn": modes.Cableway, "sesselbahn": modes.Cableway,
+	"cable_car": modes.Cableway, "chairlift": modes.Cableway, "elevator": modes.Cableway,
+}
+
+// Parse reads the stops from a DiDok CSV export, separated by semicolons or
+// commas. If the first row isn't a header we recognise, the columns are
+// taken to be where autoparse.py expected them, which has no coordinates.
+func Parse(r io.Reader, opts Options) ([]Station, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	cr := csv.NewReader(br)
+	cr.Comma = ';'
+	if line := strings.SplitN(string(first), "\n", 2)[0]; strings.Count(line, ",") > strings.Count(line, ";") {
+		cr.Comma = ','
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		for field, names := range columns {
+			for _, n := range names {
+				if h == n {
+					if _, ok := index[field]; !ok {
+						index[field] = i
+					}
+				}
+			}
+		}
+	}
+	rows, line := [][]string{}, 1
+	if _, ok := index["name"]; !ok {
+		// No header: the first row is a stop.
+		index = legacyColumns
+		rows, line = append(rows, header), 0
+	}
+	_, typed := index["type"]
+
+	stations := []Station{}
+	seen := map[string]bool{}
+	for {
+		line++
+		var row []string
+		if len(rows) > 0 {
+			row, rows = rows[0], rows[1:]
+		} else if row, err = cr.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		get := func(field string) string {
+			i, ok := index[field]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		s := Station{UIC: get("uic"), Name: get("name"), Operator: get("operator")}
+		if s.Name == "" || (typed && !stopTypes[get("type")]) || seen[s.Name] {
+			continue
+		}
+		if s.Modes = parseModes(get("modes")); !opts.keep(s) {
+			continue
+		}
+		if s.Lat, s.Lon, err = parseLatLon(get("lat"), get("lon"), get("geopos")); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		seen[s.Name] = true
+		stations = append(stations, s)
+	}
+	return stations, nil
+}
+
+func (o Options) keep(s Station) bool {
+	if len(o.Operators) > 0 && !contains(o.Operators, s.Operator) {
+		return false
+	}
+	if len(o.BusCities) > 0 && !s.Serves("train") {
+		for _, c := range o.BusCities {
+			if strings.Contains(s.Name, c) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// parseModes parses e.g. "Zug~Bus" or "TRAIN|BUS".
+func parseModes(raw string) []modes.Mode {
+	r := []modes.Mode{}
+	seen := map[modes.Mode]bool{}
+	for _, m := range strings.FieldsFunc(raw, func(c rune) bool { return c == '~' || c == '|' || c == ',' || c == ' ' }) {
+		if mode, ok := meansOfTransport[strings.ToLower(m)]; ok && !seen[mode] {
+			seen[mode] = true
+			r = append(r, mode)
+		}
+	}
+	return r
+}
+
+// parseLatLon parses coordinates from separate columns or from a geopos
+// like "47.378, 8.540".
+func parseLatLon(lat, lon, geopos string) (float64, float64, error) {
+	if lat == "" && lon == "" {
+		if geopos == "" {
+			return 0, 0, nil
+		}
+		parts := strings.Split(geopos, ",")
+		if len(parts) != 2 {
+			return 0, 0, fmt.Errorf("invalid coordinates %q", geopos)
+		}
+		lat, lon = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+	la, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude %q", lat)
+	}
+	lo, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude %q", lon)
+	}
+	return la, lo, nil
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
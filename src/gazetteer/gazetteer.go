@@ -0,0 +1,167 @@
+// Package gazetteer knows the names, synonyms, coordinates and modes of
+// Swiss public transport stops, from the SBB DiDok (service points) export.
+//
+// It replaces the offline autoparse.py script: the gazetteer command
+// generates the Dialogflow sbb_stops entity from it, and the webhook can
+// load the same data as an Index at runtime.
+package gazetteer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+
+	"modes"
+)
+
+// Station is a stop from DiDok.
+type Station struct {
+	// UIC is the stop's number, e.g. "8503000" for Zürich HB.
+	UIC  string `json:"uic"`
+	Name string `json:"name"`
+	// Synonyms are other names people use for the stop, including Name.
+	Synonyms []string `json:"synonyms,omitempty"`
+	Lat      float64  `json:"lat,omitempty"`
+	Lon      float64  `json:"lon,omitempty"`
+	// Modes are the modes of transport serving the stop.
+	Modes    []modes.Mode `json:"modes,omitempty"`
+	Operator string       `json:"operator,omitempty"`
+}
+
+// Serves returns whether mode serves s.
+func (s Station) Serves(mode modes.Mode) bool {
+	for _, m := range s.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Index looks up stations by name, synonym, UIC number or location.
+type Index struct {
+	stations []Station
+	byName   map[string]int
+	byUIC    map[string]int
+}
+
+// NewIndex indexes stations. If a synonym is shared, the first station with
+// it wins, so the stations should be in order of preference.
+func NewIndex(stations []Station) *Index {
+	ix := &Index{stations: stations, byName: map[string]int{}, byUIC: map[string]int{}}
+	for i, s := range stations {
+		if s.UIC != "" {
+			ix.byUIC[s.UIC] = i
+		}
+		for _, n := range append([]string{s.Name}, s.Synonyms...) {
+			if _, ok := ix.byName[Normalize(n)]; !ok {
+				ix.byName[Normalize(n)] = i
+			}
+		}
+	}
+	// Official names beat synonyms.
+	for i, s := range stations {
+		ix.byName[Normalize(s.Name)] = i
+	}
+	return ix
+}
+
+// Load reads an index written by Save.
+func Load(path string) (*Index, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	stations := []Station{}
+	if err := json.Unmarshal(bs, &stations); err != nil {
+		return nil, err
+	}
+	return NewIndex(stations), nil
+}
+
+// Save writes stations for Load.
+func Save(path string, stations []Station) error {
+	bs, err := json.Marshal(stations)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+// Len returns the number of stations.
+func (ix *Index) Len() int {
+	return len(ix.stations)
+}
+
+// Stations returns all stations, in the order they were indexed.
+func (ix *Index) Stations() []Station {
+	return ix.stations
+}
+
+// Lookup finds a station by its name or a synonym, ignoring case, accents
+// and punctuation.
+func (ix *Index) Lookup(name string) (Station, bool) {
+	i, ok := ix.byName[Normalize(name)]
+	if !ok {
+		return Station{}, false
+	}
+	return ix.stations[i], true
+}
+
+// ByUIC finds a station by its UIC number.
+func (ix *Index) ByUIC(uic string) (Station, bool) {
+	i, ok := ix.byUIC[uic]
+	if !ok {
+		return Station{}, false
+	}
+	return ix.stations[i], true
+}
+
+// Nearby is a station and its distance from somewhere, in meters.
+type Nearby struct {
+	Station
+	Distance float64
+}
+
+// Near returns the limit stations closest to lat/lon.
+func (ix *Index) Near(lat, lon float64, limit int) []Nearby {
+	r := []Nearby{}
+	for _, s := range ix.stations {
+		if s.Lat == 0 && s.Lon == 0 {
+			continue
+		}
+		r = append(r, Nearby{s, distance(lat, lon, s.Lat, s.Lon)})
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Distance < r[j].Distance })
+	if len(r) > limit {
+		r = r[:limit]
+	}
+	return r
+}
+
+// distance returns the great-circle distance between two points, in meters.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dlat, dlon := rad(lat2-lat1), rad(lon2-lon1)
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+var folder = strings.NewReplacer(
+	"ä", "a", "ö", "o", "ü", "u", "é", "e", "è", "e", "ê", "e", "ë", "e",
+	"à", "a", "â", "a", "î", "i", "ï", "i", "ô", "o", "û", "u", "ç", "c",
+	"ae", "a", "oe", "o", "ue", "u",
+)
+
+// Normalize folds a name for comparison: "Zürich, Bahnhofstrasse" and
+// "zuerich bahnhofstrasse" are the same.
+func Normalize(name string) string {
+	name = folder.Replace(strings.ToLower(name))
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), " ")
+}
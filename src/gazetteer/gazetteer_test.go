@@ -0,0 +1,163 @@
+package gazetteer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"modes"
+)
+
+const servicePoints = `number;designationOfficial;stopPoint;meansOfTransport;businessOrganisationAbbreviationDe;wgs84East;wgs84North
+8503000;Zürich HB;true;TRAIN;SBB;8.540192;47.378177
+8503003;Zürich Stadelhofen;true;TRAIN;SBB;8.548466;47.366611
+8591123;Zürich, Bahnhofstrasse/HB;true;TRAM|BUS;VBZ;8.539562;47.376906
+8591052;Zürich, Bellevue;true;TRAM|BUS;VBZ;8.544940;47.366994
+8507000;Bern;true;TRAIN;SBB;7.439122;46.948825
+8505000;Luzern;true;TRAIN|BOAT;SBB;8.310170;47.050168
+8596001;Bern, Bärenpark;true;BUS;BERNMOBIL;7.459520;46.948070
+8500000;Olten Werkstätte;false;;SBB;7.9;47.3
+`
+
+func TestParse(t *testing.T) {
+	stations, err := Parse(strings.NewReader(servicePoints), Options{BusCities: []string{"Zürich"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, s := range stations {
+		names = append(names, s.Name)
+	}
+	// Not Bern, Bärenpark, which only has busses, nor the workshop.
+	if want := []string{"Zürich HB", "Zürich Stadelhofen", "Zürich, Bahnhofstrasse/HB", "Zürich, Bellevue", "Bern", "Luzern"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("want %v, got %v", want, names)
+	}
+	want := Station{UIC: "8505000", Name: "Luzern", Lat: 47.050168, Lon: 8.310170, Modes: []modes.Mode{modes.Train, modes.Ship}, Operator: "SBB"}
+	if got := stations[5]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	// The 2018 export, without a header, as autoparse.py read it.
+	legacy := `1;ZUE;Zürich HB;;;;SBB;Haltestelle_und_Bedienpunkt;Zug
+2;BRP;Bern, Bärenpark;;;;BERNMOBIL;Haltestelle;Bus
+3;OWS;Olten Werkstätte;;;;SBB;Betriebspunkt;
+`
+	stations, err := Parse(strings.NewReader(legacy), Options{Operators: []string{"SBB", "BERNMOBIL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stations) != 2 || stations[0].Name != "Zürich HB" || !stations[1].Serves("bus") {
+		t.Errorf("want Zürich HB and Bern, Bärenpark, got %+v", stations)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	stations := Expand([]Station{
+		{Name: "Zürich HB"},
+		{Name: "Zürich Stadelhofen"},
+		{Name: "Zürich, Bahnhofstrasse/HB"},
+		{Name: "Genève"},
+	}, "de")
+	for _, tc := range []struct {
+		station int
+		want    string
+	}{
+		{0, "Zürich"},
+		{0, "Zuerich Hauptbahnhof"},
+		{0, "HB"},
+		{1, "Stadelhofen"},
+		{1, "Zurich Stadelhofen"},
+		{2, "Bahnhofstrasse/HB"},
+		{3, "Genf"},
+	} {
+		if !contains(stations[tc.station].Synonyms, tc.want) {
+			t.Errorf("want %q for %v, got %v", tc.want, stations[tc.station].Name, stations[tc.station].Synonyms)
+		}
+	}
+	// "HB" is Zürich HB's, not Bahnhofstrasse/HB's.
+	if contains(stations[2].Synonyms, "HB") {
+		t.Errorf("want HB for Zürich HB only, got %v", stations[2].Synonyms)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	es := Entities([]Station{
+		{Name: "Bern"},
+		{Name: "Wil (SG)", Synonyms: []string{"Wil SG", "Wil (SG)"}},
+	})
+	want := []Entity{
+		{"Bern", []string{"Bern"}},
+		{"Wil SG", []string{"Wil SG"}},
+	}
+	if !reflect.DeepEqual(es, want) {
+		t.Errorf("want %v, got %v", want, es)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	stations, err := Parse(strings.NewReader(servicePoints), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndex(Expand(stations, "en", "de"))
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"Zürich HB", "Zürich HB"},
+		{"zuerich hauptbahnhof", "Zürich HB"},
+		{"Stadelhofen", "Zürich Stadelhofen"},
+		{"bern barenpark", "Bern, Bärenpark"},
+		{"Lucerne", "Luzern"},
+	} {
+		if s, ok := ix.Lookup(tc.name); !ok || s.Name != tc.want {
+			t.Errorf("%v: want %v, got %v, %v", tc.name, tc.want, s.Name, ok)
+		}
+	}
+	if _, ok := ix.Lookup("Timbuktu"); ok {
+		t.Errorf("want no Timbuktu")
+	}
+	if s, ok := ix.ByUIC("8507000"); !ok || s.Name != "Bern" {
+		t.Errorf("want Bern, got %v, %v", s.Name, ok)
+	}
+	near := ix.Near(47.3665, 8.5450, 2)
+	if len(near) != 2 || near[0].Name != "Zürich, Bellevue" || near[1].Name != "Zürich Stadelhofen" {
+		t.Fatalf("want Bellevue and Stadelhofen, got %+v", near)
+	}
+	if near[0].Distance < 40 || near[0].Distance > 70 {
+		t.Errorf("want Bellevue about 55m away, got %vm", near[0].Distance)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		query, name string
+		min, max    float64
+	}{
+		{"zuerich hb", "Zürich HB", 1, 1},
+		{"Bahnhof Oerlikon", "Zürich Oerlikon", 0.9, 0.99},
+		{"Oerlikon", "Zürich, Oerlikon Nord", 0.85, 0.95},
+		// Sounds the same.
+		{"Wallisellen", "Walisellen", 0.85, 0.95},
+		{"Meilen", "Mailen", 0.85, 0.95},
+		{"Stadelhofen", "Bern", 0, 0},
+	} {
+		if got := Similarity(tc.query, tc.name); got < tc.min || got > tc.max {
+			t.Errorf("%v, %v: want %v to %v, got %v", tc.query, tc.name, tc.min, tc.max, got)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	stations, err := Parse(strings.NewReader(servicePoints), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndex(Expand(stations, "de"))
+	got := ix.Search("Bellvue", 0.6, 3)
+	if len(got) == 0 || got[0].Name != "Zürich, Bellevue" {
+		t.Errorf("want Bellevue first, got %+v", got)
+	}
+}
@@ -0,0 +1,209 @@
+package gazetteer
+
+import (
+	"sort"
+	"strings"
+)
+
+// generic are words in stop names which don't help tell them apart, e.g.
+// "Bahnhof Oerlikon" is Zürich Oerlikon.
+var generic = map[string]bool{
+	"bahnhof": true, "bhf": true, "bf": true, "station": true, "gare": true, "stazione": true,
+	"haltestelle": true, "stop": true,
+}
+
+// MentionsStation returns whether name has a word like "Bahnhof" or "gare",
+// meaning a railway station rather than a bus or tram stop.
+func MentionsStation(name string) bool {
+	for _, t := range strings.Fields(Normalize(name)) {
+		if generic[t] && t != "haltestelle" && t != "stop" {
+			return true
+		}
+	}
+	return false
+}
+
+func tokens(name string) []string {
+	r := []string{}
+	for _, t := range strings.Fields(Normalize(name)) {
+		if !generic[t] {
+			r = append(r, t)
+		}
+	}
+	return r
+}
+
+// Similarity scores how well query matches a stop name, from 0 to 1, where
+// 1 means they're the same once normalized. It's the average over the
+// query's words of how well each matches a word of name, by spelling or
+// sound, less a little for each word of name the query didn't mention.
+func Similarity(query, name string) float64 {
+	if Normalize(query) == Normalize(name) {
+		return 1
+	}
+	q, n := tokens(query), tokens(name)
+	if len(q) == 0 || len(n) == 0 {
+		return 0
+	}
+	used := make([]bool, len(n))
+	total := 0.0
+	for _, qt := range q {
+		best, at := 0.0, -1
+		for i, nt := range n {
+			if s := wordSimilarity(qt, nt); s > best {
+				best, at = s, i
+			}
+		}
+		if at >= 0 {
+			used[at] = true
+		}
+		total += best
+	}
+	score := total / float64(len(q))
+	for _, u := range used {
+		if !u {
+			score -= 0.05
+		}
+	}
+	// Never as good as an exact match.
+	if score > 0.99 {
+		score = 0.99
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+func wordSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if phonetic(a) == phonetic(b) {
+		return 0.9
+	}
+	s := 1 - float64(editDistance(a, b))/float64(max(len(a), len(b)))
+	if s < 0.5 {
+		// Not worth counting.
+		return 0
+	}
+	return s * 0.85
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// phonetic is the Kölner Phonetik code of a normalized word: words which
+// sound alike in German, like "Meier" and "Mayer", have the same code.
+func phonetic(word string) string {
+	code := []byte{}
+	w := []byte(word)
+	at := func(i int) byte {
+		if i < 0 || i >= len(w) {
+			return 0
+		}
+		return w[i]
+	}
+	in := func(c byte, set string) bool { return c != 0 && strings.IndexByte(set, c) >= 0 }
+	for i, c := range w {
+		prev, next := at(i-1), at(i+1)
+		var d byte
+		switch {
+		case in(c, "aeijouy"):
+			d = '0'
+		case c == 'h':
+			continue
+		case c == 'b':
+			d = '1'
+		case c == 'p':
+			d = '1'
+			if next == 'h' {
+				d = '3'
+			}
+		case in(c, "dt"):
+			d = '2'
+			if in(next, "csz") {
+				d = '8'
+			}
+		case in(c, "fvw"):
+			d = '3'
+		case in(c, "gkq"):
+			d = '4'
+		case c == 'c':
+			if i == 0 {
+				d = '8'
+				if in(next, "ahkloqrux") {
+					d = '4'
+				}
+			} else {
+				d = '8'
+				if in(next, "ahkoqux") && !in(prev, "sz") {
+					d = '4'
+				}
+			}
+		case c == 'x':
+			d = '8'
+			if !in(prev, "ckq") {
+				code = append(code, '4')
+			}
+		case c == 'l':
+			d = '5'
+		case in(c, "mn"):
+			d = '6'
+		case c == 'r':
+			d = '7'
+		case in(c, "sz"):
+			d = '8'
+		default:
+			// Digits and the like are kept as they are.
+			d = c
+		}
+		code = append(code, d)
+	}
+	// Collapse repeats, then drop vowels except at the start.
+	r := []byte{}
+	for i, d := range code {
+		if i > 0 && d == code[i-1] {
+			continue
+		}
+		if d == '0' && i > 0 {
+			continue
+		}
+		r = append(r, d)
+	}
+	return string(r)
+}
+
+// Match is a station which a name might mean.
+type Match struct {
+	Station
+	// Score is the Similarity of the name to the station's name or one of
+	// its synonyms, whichever is best.
+	Score float64
+}
+
+// Search returns up to limit stations whose names or synonyms are at least
+// minScore Similar to name, best first.
+func (ix *Index) Search(name string, minScore float64, limit int) []Match {
+	r := []Match{}
+	for _, s := range ix.stations {
+		best := 0.0
+		for _, n := range append([]string{s.Name}, s.Synonyms...) {
+			if x := Similarity(name, n); x > best {
+				best = x
+			}
+		}
+		if best >= minScore {
+			r = append(r, Match{s, best})
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Score > r[j].Score })
+	if len(r) > limit {
+		r = r[:limit]
+	}
+	return r
+}
@@ -0,0 +1,208 @@
+package gazetteer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type replacement struct {
+	re   *regexp.Regexp
+	with string
+}
+
+func replace(re, with string) replacement {
+	return replacement{regexp.MustCompile(re), with}
+}
+
+// replacements generate the variations of a stop's name people say, e.g.
+// "Stadelhofen" for "Zürich Stadelhofen". They're applied repeatedly, so
+// they combine.
+var replacements = []replacement{
+	replace(`\s*Z[üu]rich\s*`, ""),
+	replace(`(^|[\s,/]+)Bahnhof([\s,/]+|$)`, ""),
+	replace(`ü`, "ue"),
+	replace(`ü`, "u"),
+	replace(`ö`, "oe"),
+	replace(`ö`, "o"),
+	replace(`ä`, "ae"),
+	replace(`ä`, "a"),
+	replace(`,`, ""),
+	replace(`,?\sHB`, " Hauptbahnhof"),
+	replace(`,?\sHB`, ""),
+	replace(`,?\sHauptbahnhof`, " HB"),
+	replace(`,?\sHauptbahnhof`, ""),
+	replace(`[()]`, ""),
+	replace(`\s*\(.*\)\s*`, ""),
+	replace(`Basel`, "Bâle"),
+	replace(`Genèv`, "Genf"),
+}
+
+// exonyms are what places are called in each language, where that differs.
+var exonyms = map[string][]replacement{
+	"en": {
+		replace(`^Genève`, "Geneva"),
+		replace(`^Luzern`, "Lucerne"),
+		replace(`^Zürich`, "Zurich"),
+		replace(`^Basel`, "Basle"),
+	},
+	"de": {
+		replace(`^Genève`, "Genf"),
+		replace(`^Neuchâtel`, "Neuenburg"),
+		replace(`^Fribourg`, "Freiburg"),
+		replace(`^Sion`, "Sitten"),
+		replace(`^Biel/Bienne`, "Biel"),
+	},
+	"fr": {
+		replace(`^Basel`, "Bâle"),
+		replace(`^Luzern`, "Lucerne"),
+		replace(`^Bern\b`, "Berne"),
+		replace(`^Zürich`, "Zurich"),
+		replace(`^Biel/Bienne`, "Bienne"),
+		replace(`^St\. Gallen`, "Saint-Gall"),
+	},
+}
+
+var trimSeparators = regexp.MustCompile(`(^[, ]+)|([, ]+$)`)
+
+// variations returns name and the variations of it generated by
+// replacements and the exonyms in langs.
+func variations(name string, langs []string) map[string]bool {
+	set := map[string]bool{name: true}
+	unchanged := 0
+	// Two passes to get multiple permutations.
+	for i := 0; i < len(replacements)*2 && unchanged <= 2; i++ {
+		next := map[string]bool{}
+		for v := range set {
+			next[v] = true
+			for _, r := range replacements {
+				next[trimSeparators.ReplaceAllString(r.re.ReplaceAllString(v, r.with), "")] = true
+			}
+		}
+		if len(next) == len(set) {
+			unchanged++
+		}
+		set = next
+	}
+	for _, lang := range langs {
+		for v := range set {
+			for _, r := range exonyms[lang] {
+				if x := r.re.ReplaceAllString(v, r.with); x != v {
+					set[x] = true
+				}
+			}
+		}
+	}
+	delete(set, "")
+	return set
+}
+
+// Expand returns a copy of stations with the Synonyms people use in langs
+// added. A synonym shared by several stations is kept only for the one whose
+// name it's closest to, e.g. "Zürich" is Zürich HB.
+func Expand(stations []Station, langs ...string) []Station {
+	syns := make([]map[string]bool, len(stations))
+	owner := map[string]int{}
+	for i, s := range stations {
+		syns[i] = variations(s.Name, langs)
+		for _, x := range s.Synonyms {
+			syns[i][x] = true
+		}
+		for _, alt := range sorted(syns[i]) {
+			j, ok := owner[alt]
+			if !ok {
+				owner[alt] = i
+				continue
+			}
+			// Prefer the name with the lower edit distance.
+			if editDistance(alt, stations[j].Name) <= editDistance(alt, s.Name) {
+				delete(syns[i], alt)
+			} else {
+				delete(syns[j], alt)
+				owner[alt] = i
+			}
+		}
+	}
+	r := make([]Station, len(stations))
+	for i, s := range stations {
+		s.Synonyms = sorted(syns[i])
+		r[i] = s
+	}
+	return r
+}
+
+func sorted(set map[string]bool) []string {
+	r := make([]string, 0, len(set))
+	for x := range set {
+		r = append(r, x)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur := make([]int, len(t)+1)
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(cur[j-1]+1, prev[j]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(t)]
+}
+
+func min(x int, xs ...int) int {
+	for _, y := range xs {
+		if y < x {
+			x = y
+		}
+	}
+	return x
+}
+
+// Entity is an entry of a Dialogflow entity.
+type Entity struct {
+	Value    string   `json:"value"`
+	Synonyms []string `json:"synonyms"`
+}
+
+var parens = strings.NewReplacer("(", "", ")", "")
+
+// Entities returns the entries of the sbb_stops entity for stations, which
+// should have been Expanded. Dialogflow doesn't allow parentheses in values,
+// so they're dropped, and stations which then have the same name are
+// merged; synonyms with parentheses are dropped.
+func Entities(stations []Station) []Entity {
+	byValue := map[string]map[string]bool{}
+	for _, s := range stations {
+		value := parens.Replace(s.Name)
+		if byValue[value] == nil {
+			byValue[value] = map[string]bool{value: true}
+		}
+		for _, x := range append([]string{s.Name}, s.Synonyms...) {
+			if !strings.ContainsAny(x, "()") {
+				byValue[value][x] = true
+			}
+		}
+	}
+	r := []Entity{}
+	values := make(map[string]bool, len(byValue))
+	for v := range byValue {
+		values[v] = true
+	}
+	for _, v := range sorted(values) {
+		r = append(r, Entity{Value: v, Synonyms: sorted(byValue[v])})
+	}
+	return r
+}
@@ -0,0 +1,168 @@
+package lines
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gazetteer"
+	"modes"
+)
+
+// A Route is a line read from a GTFS feed.
+type Route struct {
+	// Name is the line as it's written on the departure board, e.g. "S12"
+	// or "4".
+	Name string
+	Mode modes.Mode
+	// Operator is the GTFS agency_id.
+	Operator string
+}
+
+// ParseRoutes reads the routes of every operator from a GTFS routes.txt,
+// or those of operators if any are given. Routes with the same name and
+// mode are only returned once.
+//
+// Swiss feeds put the category in route_desc and sometimes leave it out of
+// route_short_name, so an S-Bahn may be "12" with a description of "S";
+// that's returned as "S12".
+func ParseRoutes(r io.Reader, operators ...string) ([]Route, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	if _, ok := index["route_short_name"]; !ok {
+		return nil, fmt.Errorf("no route_short_name column")
+	}
+
+	routes := []Route{}
+	seen := map[Route]bool{}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		get := func(field string) string {
+			i, ok := index[field]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		rt := Route{Name: get("route_short_name"), Mode: modes.FromRouteType(get("route_type")), Operator: get("agency_id")}
+		if rt.Name == "" || (len(operators) > 0 && !contains(operators, rt.Operator)) {
+			continue
+		}
+		if desc := strings.ToUpper(get("route_desc")); categories[desc] && !strings.HasPrefix(strings.ToUpper(rt.Name), desc) {
+			rt.Name = desc + rt.Name
+		}
+		key := Route{Name: rt.Name, Mode: rt.Mode}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if strings.EqualFold(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// categories are the route_desc values which are written before the
+// number.
+var categories = map[string]bool{
+	"S": true, "SN": true, "IC": true, "ICE": true, "IR": true, "RE": true, "EC": true, "EN": true,
+	"TGV": true, "IN": true, "PE": true, "R": true, "N": true,
+}
+
+// spoken are the ways of saying a category followed by a number, by
+// language.
+var spoken = map[string]map[string][]string{
+	"S":  {"en": {"S-Bahn"}, "de": {"S-Bahn"}, "fr": {"RER"}},
+	"SN": {"en": {"night S-Bahn"}, "de": {"Nacht-S-Bahn"}, "fr": {"RER de nuit"}},
+	"IC": {"en": {"Intercity"}, "de": {"Intercity"}, "fr": {"Intercity"}},
+	"IR": {"en": {"InterRegio"}, "de": {"InterRegio"}, "fr": {"InterRegio"}},
+	"RE": {"en": {"RegioExpress"}, "de": {"RegioExpress"}, "fr": {"RegioExpress"}},
+	"N":  {"en": {"night bus"}, "de": {"Nachtbus"}, "fr": {"bus de nuit"}},
+}
+
+// modeNames are the ways of saying a mode followed by a number, by
+// language.
+var modeNames = map[modes.Mode]map[string][]string{
+	modes.Tram:  {"en": {"tram", "line"}, "de": {"Tram", "Linie"}, "fr": {"tram", "ligne"}},
+	modes.Bus:   {"en": {"bus", "line"}, "de": {"Bus", "Linie"}, "fr": {"bus", "ligne"}},
+	modes.Metro: {"en": {"metro"}, "de": {"Metro"}, "fr": {"métro"}},
+}
+
+// Entities returns the entries of the routes entity in lang for routes.
+// Routes of different operators with the same name are one entry, e.g.
+// every town's bus number 1.
+func Entities(routes []Route, lang string) []gazetteer.Entity {
+	byValue := map[string]map[string]bool{}
+	for _, rt := range routes {
+		if byValue[rt.Name] == nil {
+			byValue[rt.Name] = map[string]bool{rt.Name: true}
+		}
+		for _, s := range synonyms(rt, lang) {
+			byValue[rt.Name][s] = true
+		}
+	}
+	values := make([]string, 0, len(byValue))
+	for v := range byValue {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	es := []gazetteer.Entity{}
+	for _, v := range values {
+		e := gazetteer.Entity{Value: v, Synonyms: []string{v}}
+		others := []string{}
+		for s := range byValue[v] {
+			if s != v {
+				others = append(others, s)
+			}
+		}
+		sort.Strings(others)
+		e.Synonyms = append(e.Synonyms, others...)
+		es = append(es, e)
+	}
+	return es
+}
+
+func synonyms(rt Route, lang string) []string {
+	l := Parse(rt.Name)
+	if l.Number == "" {
+		return nil
+	}
+	r := []string{}
+	if l.Prefix != "" {
+		r = append(r, l.Prefix+" "+l.Number)
+		for _, w := range spoken[l.Prefix][lang] {
+			r = append(r, w+" "+l.Number)
+		}
+		return r
+	}
+	for _, w := range modeNames[rt.Mode][lang] {
+		r = append(r, w+" "+l.Number)
+	}
+	return r
+}
@@ -0,0 +1,86 @@
+// Package lines recognises public transport lines however people say them,
+// e.g. "S 12", "S-Bahn 12" or just "12" for the S12, and generates the
+// Dialogflow routes entity from GTFS.
+package lines
+
+import (
+	"regexp"
+	"strings"
+
+	"modes"
+)
+
+// A Line is a line name split into its parts: "S12" is {Prefix: "S",
+// Number: "12"}, "tram 4" is {Mode: "tram", Number: "4"}.
+type Line struct {
+	// Mode is the mode of transport, if it was said.
+	Mode modes.Mode
+	// Prefix is the category, e.g. "S", "IC" or "N", in upper case.
+	Prefix string
+	// Number is e.g. "12" or "2E".
+	Number string
+}
+
+// prefixWords are words meaning a prefix.
+var prefixWords = map[string]string{
+	"s-bahn": "S", "sbahn": "S",
+	"intercity": "IC", "interregio": "IR", "regioexpress": "RE", "eurocity": "EC",
+	"nachtbus": "N", "nachtzug": "SN",
+}
+
+// fillers are words which don't change which line is meant.
+var fillers = map[string]bool{
+	"line": true, "linie": true, "ligne": true, "number": true, "nummer": true,
+	"nr": true, "no": true, "the": true, "der": true, "die": true, "le": true, "la": true,
+}
+
+// lineCode is a line's prefix and number, e.g. "S 12", "N68" or "2E".
+var lineCode = regexp.MustCompile(`^([A-Z]*)[\s-]*(\d+[A-Z]?)?$`)
+
+// Parse splits a line name. Anything it doesn't understand is kept as the
+// Prefix, so it only matches itself.
+func Parse(name string) Line {
+	l := Line{}
+	words := []string{}
+	for _, w := range strings.Fields(strings.ToLower(name)) {
+		switch {
+		case prefixWords[w] != "":
+			words = append(words, strings.ToLower(prefixWords[w]))
+		case modes.Parse(w) != modes.Unknown:
+			l.Mode = modes.Parse(w)
+		case !fillers[w]:
+			words = append(words, w)
+		}
+	}
+	code := strings.ToUpper(strings.Join(words, " "))
+	m := lineCode.FindStringSubmatch(code)
+	if m == nil {
+		l.Prefix = code
+		return l
+	}
+	l.Prefix, l.Number = m[1], m[2]
+	return l
+}
+
+// String returns the line as it's usually written, e.g. "S12" or "4".
+func (l Line) String() string {
+	return l.Prefix + l.Number
+}
+
+// Match returns whether a departure of line name and mode is what was
+// asked for by want: "S 12", "S12" and "12" match the S12, "IC 1" the IC1,
+// and "tram 4" or "4" the number 4 tram.
+func Match(want, name string, mode modes.Mode) bool {
+	if strings.EqualFold(strings.TrimSpace(want), strings.TrimSpace(name)) {
+		return true
+	}
+	w, n := Parse(want), Parse(name)
+	if w.Mode != modes.Unknown && w.Mode != mode {
+		return false
+	}
+	if w.Number == "" {
+		// Just a mode, or a category like "IC".
+		return w.Prefix == "" || w.Prefix == n.Prefix
+	}
+	return w.Number == n.Number && (w.Prefix == "" || w.Prefix == n.Prefix)
+}
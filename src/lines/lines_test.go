@@ -0,0 +1,86 @@
+package lines
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"modes"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want Line
+	}{
+		{"S12", Line{Prefix: "S", Number: "12"}},
+		{"S 12", Line{Prefix: "S", Number: "12"}},
+		{"S-Bahn 12", Line{Prefix: "S", Number: "12"}},
+		{"12", Line{Number: "12"}},
+		{"IC 1", Line{Prefix: "IC", Number: "1"}},
+		{"Intercity 1", Line{Prefix: "IC", Number: "1"}},
+		{"tram 4", Line{Mode: "tram", Number: "4"}},
+		{"Linie 4", Line{Number: "4"}},
+		{"N68", Line{Prefix: "N", Number: "68"}},
+		{"2E", Line{Number: "2E"}},
+		{"IC", Line{Prefix: "IC"}},
+		{"1-Y", Line{Prefix: "1-Y"}},
+	} {
+		if got := Parse(tc.name); got != tc.want {
+			t.Errorf("%q: want %+v, got %+v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		want, name string
+		mode       modes.Mode
+		match      bool
+	}{
+		{"S12", "S12", "train", true},
+		{"S 12", "S12", "train", true},
+		{"12", "S12", "train", true},
+		{"s12", "S12", "train", true},
+		{"S12", "S1", "train", false},
+		{"S12", "SN12", "train", false},
+		{"IC1", "IC 1", "train", true},
+		{"IC", "IC5", "train", true},
+		{"IC", "IR13", "train", false},
+		{"tram 4", "4", "tram", true},
+		{"tram 4", "4", "bus", false},
+		{"4", "4", "bus", true},
+		{"4", "14", "bus", false},
+		{"1-Y", "1-Y", "bus", true},
+		{"LAF", "4", "tram", false},
+	} {
+		if got := Match(tc.want, tc.name, tc.mode); got != tc.match {
+			t.Errorf("Match(%q, %q, %q): want %v, got %v", tc.want, tc.name, tc.mode, tc.match, got)
+		}
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(strings.NewReader(`route_id,agency_id,route_short_name,route_long_name,route_desc,route_type
+91-12-A-j18-1,11,S12,,S,109
+91-12-A-j18-2,11,12,,S,109
+1-4-j18-1,3849,4,,T,900
+1-4-j18-2,801,4,,B,700
+1-N68-j18-1,3849,N68,,N,705
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[{S12 train 11} {4 tram 3849} {4 bus 801} {N68 bus 3849}]"; fmt.Sprint(routes) != want {
+		t.Errorf("want %v, got %v", want, routes)
+	}
+
+	got := fmt.Sprint(Entities(routes, "de"))
+	if want := "[{4 [4 Bus 4 Linie 4 Tram 4]} {N68 [N68 N 68 Nachtbus 68]} {S12 [S12 S 12 S-Bahn 12]}]"; got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if routes, err = ParseRoutes(strings.NewReader("route_id,agency_id,route_short_name\nx,801,4\n"), "11"); err != nil || len(routes) != 0 {
+		t.Errorf("want no routes, got %v, %v", routes, err)
+	}
+}
@@ -1,13 +1,17 @@
 package localize
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"strings"
 	"time"
 
 	"github.com/nicksnyder/go-i18n/i18n"
 	"golang.org/x/text/language"
+
+	"modes"
 )
 
 const dataDir = "./data"
@@ -18,22 +22,56 @@ type Localizer struct {
 	t    i18n.TranslateFunc
 }
 
-var matcher = language.NewMatcher([]language.Tag{
+// supported are the languages there are translations for.
+var supported = []language.Tag{
 	language.English, // The first language is used as fallback.
 	language.German,
 	language.French,
-})
+}
+
+var matcher = language.NewMatcher(supported)
 
 func init() {
-	files, err := ioutil.ReadDir(dataDir)
-	if err != nil {
+	// Programs not run from a directory with the translations (i.e. not
+	// the App Engine app) must call LoadTranslations themselves.
+	if err := LoadTranslations(dataDir); err != nil && !os.IsNotExist(err) {
 		panic(err)
 	}
+}
+
+// LoadTranslations loads all translation files in dir.
+func LoadTranslations(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
 	for _, f := range files {
 		if strings.HasSuffix(f.Name(), ".all.json") {
-			i18n.MustLoadTranslationFile(path.Join(dataDir, f.Name()))
+			if err := i18n.LoadTranslationFile(path.Join(dir, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Loaded returns an error naming the supported languages without
+// translations, e.g. because LoadTranslations wasn't given their directory.
+func Loaded() error {
+	loaded := map[string]bool{}
+	for _, tag := range i18n.LanguageTags() {
+		loaded[tag] = true
+	}
+	missing := []string{}
+	for _, tag := range supported {
+		if b, _ := tag.Base(); !loaded[b.String()] {
+			missing = append(missing, b.String())
 		}
 	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no translations for %s", strings.Join(missing, ", "))
+	}
+	return nil
 }
 
 func NewLocalizer(lang string, timezone *time.Location) Localizer {
@@ -44,6 +82,11 @@ func NewLocalizer(lang string, timezone *time.Location) Localizer {
 	return Localizer{tag, timezone, t}
 }
 
+// Timezone returns the timezone times are given in.
+func (l *Localizer) Timezone() *time.Location {
+	return l.tz
+}
+
 type Station struct {
 	Name     string
 	Distance float64
@@ -55,10 +98,115 @@ type Departure struct {
 	From         string
 	To           string
 	Departing    time.Time
-	Mode         string
+	Mode         modes.Mode
+	Platform     string
+	// PlatformChanged is set if it's not leaving from the platform it's
+	// scheduled to, which is ScheduledPlatform if we know.
+	PlatformChanged   bool
+	ScheduledPlatform string
+	Cancelled         bool
+	// Disruptions are the service messages about it.
+	Disruptions []Disruption
+	// Stops are where it stops after From, if known.
+	Stops []Stop
+	// TripID identifies its whole run, for query.Trip.
+	TripID string
+	// StepFree is set if the provider says it can be boarded without
+	// steps, e.g. a low-floor tram. Unset means we don't know.
+	StepFree bool
+	// Occupancy1st and Occupancy2nd are how busy it's expected to be in
+	// each class.
+	Occupancy1st Occupancy
+	Occupancy2nd Occupancy
+}
+
+// Occupancy is how busy a vehicle is expected to be, on opendata.ch's
+// scale.
+type Occupancy int
+
+const (
+	OccupancyUnknown Occupancy = iota
+	OccupancyLow
+	OccupancyMedium
+	OccupancyHigh
+)
+
+// A Stop is where a departure stops on its way.
+type Stop struct {
+	Name string
+	// Arriving and Departing are the scheduled times; either may be zero,
+	// e.g. at the terminal.
+	Arriving  time.Time
+	Departing time.Time
+	// MinutesDelay is how late it is there: arriving, or departing if it
+	// doesn't arrive.
+	MinutesDelay int
 	Platform     string
 }
 
+// ExpectedArrival is when it's expected to arrive, or zero.
+func (s Stop) ExpectedArrival() time.Time {
+	if s.Arriving.IsZero() {
+		return s.Arriving
+	}
+	return s.Arriving.Add(time.Duration(s.MinutesDelay) * time.Minute)
+}
+
+// ExpectedDeparture is when it's expected to depart, or zero.
+func (s Stop) ExpectedDeparture() time.Time {
+	if s.Departing.IsZero() {
+		return s.Departing
+	}
+	return s.Departing.Add(time.Duration(s.MinutesDelay) * time.Minute)
+}
+
+// A Position is where a vehicle is estimated to be on its way to a stop.
+type Position struct {
+	// Last is the stop it last left, or nil if it hasn't left Next, its
+	// first stop, yet. If it's standing at a stop, both are that stop.
+	Last, Next *Stop
+	// StopsAway is how many stops it has to go to the stop, and Minutes
+	// about how long it takes.
+	StopsAway int
+	Minutes   int
+}
+
+// A Fare is the price of a 2nd class single ticket in CHF.
+type Fare struct {
+	Full float64
+	// Half is with a half-fare card.
+	Half float64
+	// Network and Zones are the tariff network and how many zones it's
+	// for, if it's a zone fare.
+	Network string
+	Zones   int
+}
+
+// A Disruption is a service message, e.g. about construction work.
+type Disruption struct {
+	ID string
+	// Header is a one line summary, e.g. "Zürich HB - Stadelhofen:
+	// construction work".
+	Header string
+	// Text is the details, if any.
+	Text string
+	// Start and End are when it applies, if known.
+	Start time.Time
+	End   time.Time
+	// Lines are the lines it's known to affect, e.g. "S8".
+	Lines []string
+}
+
+// Mode names count of a mode, e.g. "trams".
+func (l *Localizer) Mode(m modes.Mode, count int) string {
+	for _, known := range modes.All {
+		if m == known {
+			return l.t("mode_"+string(m), count)
+		}
+	}
+	return string(m)
+}
+
 func (l *Localizer) NeedLocation() string {
 	return l.t("location_needed")
 }
@@ -86,36 +234,59 @@ func (l *Localizer) Stations(near string, stations []Station) string {
 }
 
 func (l *Localizer) NextDepartures(from, to string, startTime time.Time, deps []Departure) string {
+	return l.withDisruptions(l.nextDepartures(from, to, startTime, deps, plainText{}), deps, plainText{})
+}
+
+// busyKey returns the key of the warning that d is expected to be very
+// busy, if it is.
+func busyKey(d Departure) string {
+	switch {
+	case d.Occupancy1st == OccupancyHigh && d.Occupancy2nd == OccupancyHigh:
+		return "very_busy"
+	case d.Occupancy2nd == OccupancyHigh:
+		return "very_busy_2nd"
+	case d.Occupancy1st == OccupancyHigh:
+		return "very_busy_1st"
+	}
+	return ""
+}
+
+// departureParts phrases each departure, e.g. "the 7 tram departing on-time
+// at 15:04 to Farbhof".
+func (l *Localizer) departureParts(deps []Departure, r renderer) []string {
 	parts := []string{}
 	for _, d := range deps {
 		// "the 7 tram departing on-time at 15:04 to Farbhof"
 		// d.Name, d.Mode, d.MinutesDelay, d.Departing, d.MinutesDelay, d.To
-		tm := d.Departing.In(l.tz).Format("15:04")
-		var name string
-		switch d.Mode {
-		case "bus":
-			name = l.t("bus", map[string]interface{}{"Name": d.Name})
-		case "tram":
-			name = l.t("tram", map[string]interface{}{"Name": d.Name})
-		case "train":
-			name = l.t("train", map[string]interface{}{"Name": d.Name})
-		case "ship":
-			name = l.t("ship", map[string]interface{}{"Name": d.Name})
-		default:
-			name = l.t("unknown_mode", map[string]interface{}{"Name": d.Name})
+		tm := r.time(d.Departing.In(l.tz).Format("15:04"))
+		key := "unknown_mode"
+		for _, m := range modes.All {
+			if d.Mode == m {
+				key = string(m)
+			}
+		}
+		name := l.t(key, map[string]interface{}{"Name": r.line(d.Name)})
+		if d.Cancelled {
+			// Its delay and platform don't matter any more.
+			parts = append(parts, l.t("the_7_tram_cancelled_at_1504_to_farbhof", map[string]interface{}{
+				"Name":        name,
+				"Time":        tm,
+				"Destination": r.station(d.To),
+			}))
+			continue
 		}
-		if d.Platform == "" {
+		if d.Platform == "" || d.PlatformChanged {
 			if d.MinutesDelay < 1 {
 				parts = append(parts, l.t("the_7_tram_on_time_at_1504_to_farbhof", map[string]interface{}{
 					"Name":        name,
 					"Time":        tm,
-					"Destination": d.To,
+					"Destination": r.station(d.To),
 				}))
 			} else {
 				parts = append(parts, l.t("the_7_tram_with_a_5_minute_delay_at_1504_to_farbhof", map[string]interface{}{
 					"Name":        name,
 					"Time":        tm,
-					"Destination": d.To,
+					"Destination": r.station(d.To),
 					"Delay":       d.MinutesDelay,
 				}))
 			}
@@ -124,52 +295,470 @@ func (l *Localizer) NextDepartures(from, to string, startTime time.Time, deps []
 				parts = append(parts, l.t("the_7_tram_on_time_from_platform_2_at_1504_to_farbhof", map[string]interface{}{
 					"Name":        name,
 					"Time":        tm,
-					"Destination": d.To,
-					"Platform":    d.Platform,
+					"Destination": r.station(d.To),
+					"Platform":    r.platform(d.Platform),
 				}))
 			} else {
 				parts = append(parts, l.t("the_7_tram_with_a_5_minute_delay_from_platform_2_at_1504_to_farbhof", map[string]interface{}{
 					"Name":        name,
 					"Time":        tm,
-					"Destination": d.To,
+					"Destination": r.station(d.To),
 					"Delay":       d.MinutesDelay,
-					"Platform":    d.Platform,
+					"Platform":    r.platform(d.Platform),
 				}))
 			}
 		}
+		if d.StepFree {
+			parts[len(parts)-1] = l.t("step_free", map[string]interface{}{"Departure": parts[len(parts)-1]})
+		}
+		if id := busyKey(d); id != "" {
+			parts[len(parts)-1] = l.t(id, map[string]interface{}{"Departure": parts[len(parts)-1]})
+		}
+		if d.Platform != "" && d.PlatformChanged {
+			// Say the new platform last, so it's not missed.
+			args := map[string]interface{}{
+				"Departure": parts[len(parts)-1],
+				"Platform":  r.platform(d.Platform),
+				"Scheduled": r.platform(d.ScheduledPlatform),
+			}
+			if d.ScheduledPlatform == "" {
+				parts[len(parts)-1] = l.t("platform_changed", args)
+			} else {
+				parts[len(parts)-1] = l.t("platform_changed_instead", args)
+			}
+		}
 	}
+	return parts
+}
 
+func (l *Localizer) nextDepartures(from, to string, startTime time.Time, deps []Departure, r renderer) string {
+	parts := l.departureParts(deps, r)
 	if len(parts) == 0 {
 		return l.t("could_not_find_any_routes")
 	}
 
 	if startTime.IsZero() && to == "" {
 		return l.t("next_departures", len(parts), map[string]interface{}{
-			"From":       from,
-			"Departures": strings.Join(parts[:len(parts)-1], "; "),
+			"From":       r.station(from),
+			"Departures": r.join(parts[:len(parts)-1]),
 			"Last":       parts[len(parts)-1],
 		})
 	} else if startTime.IsZero() && to != "" {
 		return l.t("next_departures_to", len(parts), map[string]interface{}{
-			"From":       from,
-			"To":         to,
-			"Departures": strings.Join(parts[:len(parts)-1], "; "),
+			"From":       r.station(from),
+			"To":         r.station(to),
+			"Departures": r.join(parts[:len(parts)-1]),
 			"Last":       parts[len(parts)-1],
 		})
 	} else if !startTime.IsZero() && to == "" {
 		return l.t("next_departures_at", len(parts), map[string]interface{}{
-			"From":       from,
-			"Departures": strings.Join(parts[:len(parts)-1], "; "),
+			"From":       r.station(from),
+			"Departures": r.join(parts[:len(parts)-1]),
 			"Last":       parts[len(parts)-1],
-			"Time":       startTime.In(l.tz).Format("15:04"),
+			"Time":       r.time(startTime.In(l.tz).Format("15:04")),
 		})
 	} else /* !startTime.IsZero() && to != "" */ {
 		return l.t("next_departures_to_at", len(parts), map[string]interface{}{
-			"From":       from,
-			"To":         to,
-			"Departures": strings.Join(parts[:len(parts)-1], "; "),
+			"From":       r.station(from),
+			"To":         r.station(to),
+			"Departures": r.join(parts[:len(parts)-1]),
 			"Last":       parts[len(parts)-1],
-			"Time":       startTime.In(l.tz).Format("15:04"),
+			"Time":       r.time(startTime.In(l.tz).Format("15:04")),
 		})
 	}
 }
+
+// WindowDepartures summarizes the departures between start and end: how
+// many there are, count, and the first few of them, deps.
+func (l *Localizer) WindowDepartures(from, to string, start, end time.Time, deps []Departure, count int) string {
+	return l.withDisruptions(l.windowDepartures(from, to, start, end, deps, count, plainText{}), deps, plainText{})
+}
+
+// withDisruptions briefly mentions the disruptions affecting deps after
+// speech.
+func (l *Localizer) withDisruptions(speech string, deps []Departure, r renderer) string {
+	ds := collectDisruptions(deps)
+	if len(ds) == 0 {
+		return speech
+	}
+	return speech + " " + l.t("disruption_note", len(ds), map[string]interface{}{"Header": r.text(strings.TrimRight(ds[0].Header, "."))})
+}
+
+// collectDisruptions returns the disruptions of deps, once each.
+func collectDisruptions(deps []Departure) []Disruption {
+	ds := []Disruption{}
+	seen := map[string]bool{}
+	for _, d := range deps {
+		for _, x := range d.Disruptions {
+			if !seen[x.ID] {
+				seen[x.ID] = true
+				ds = append(ds, x)
+			}
+		}
+	}
+	return ds
+}
+
+// StopsAt answers whether d stops at station, where stop is its stop there
+// if it does.
+func (l *Localizer) StopsAt(d Departure, station string, stop *Stop) string {
+	return l.call("stops_at", d, station, stop)
+}
+
+// ArrivesAt answers when d arrives at station, where stop is its stop there
+// if it does.
+func (l *Localizer) ArrivesAt(d Departure, station string, stop *Stop) string {
+	return l.call("arrives_at", d, station, stop)
+}
+
+func (l *Localizer) call(id string, d Departure, station string, stop *Stop) string {
+	args := map[string]interface{}{
+		"Name":    d.Name,
+		"Time":    d.Departing.In(l.tz).Format("15:04"),
+		"To":      d.To,
+		"Station": station,
+	}
+	switch {
+	case stop != nil:
+		at := stop.ExpectedArrival()
+		if at.IsZero() {
+			at = stop.ExpectedDeparture()
+		}
+		args["Station"] = stop.Name
+		args["Arrival"] = at.In(l.tz).Format("15:04")
+		return l.t(id, args)
+	case len(d.Stops) == 0:
+		return l.t("stops_unknown", args)
+	}
+	return l.t(id+"_not", args)
+}
+
+// TripPosition says where d is, between its stops last and next as
+// query.Progress finds them.
+func (l *Localizer) TripPosition(d Departure, last, next *Stop) string {
+	args := map[string]interface{}{"Name": d.Name, "To": d.To}
+	hhmm := func(t time.Time) string { return t.In(l.tz).Format("15:04") }
+	switch {
+	case last == nil && next == nil:
+		return l.t("trip_unknown")
+	case last == nil:
+		args["Station"], args["Time"] = next.Name, hhmm(next.ExpectedDeparture())
+		return l.t("trip_position_before", args)
+	case next == nil:
+		args["Station"], args["Time"] = last.Name, hhmm(last.ExpectedArrival())
+		return l.t("trip_position_arrived", args)
+	case last == next:
+		args["Station"], args["Time"] = last.Name, hhmm(last.ExpectedDeparture())
+		return l.t("trip_position_at", args)
+	}
+	args["Last"], args["LastTime"] = last.Name, hhmm(last.ExpectedDeparture())
+	args["Station"], args["Time"] = next.Name, hhmm(next.ExpectedArrival())
+	return l.t("trip_position", args)
+}
+
+// VehiclePosition says where the vehicle running d is on its way to
+// station, or that we don't know if pos is nil.
+func (l *Localizer) VehiclePosition(d Departure, station string, pos *Position) string {
+	args := map[string]interface{}{"Name": d.Name, "From": d.From, "Station": station}
+	switch {
+	case pos == nil:
+		return l.t("vehicle_unknown", args)
+	case pos.StopsAway == 0:
+		return l.t("vehicle_here", args)
+	}
+	args["Away"] = l.t("stops_away", pos.StopsAway)
+	args["Minutes"] = l.t("minutes_away", pos.Minutes)
+	switch {
+	case pos.Last == nil:
+		args["Last"] = pos.Next.Name
+		return l.t("vehicle_before", args)
+	case pos.Last == pos.Next:
+		args["Last"] = pos.Last.Name
+		return l.t("vehicle_at", args)
+	}
+	args["Last"], args["Next"] = pos.Last.Name, pos.Next.Name
+	return l.t("vehicle_between", args)
+}
+
+// TripUnknown says we don't know which trip the user means, or can't look
+// it up.
+func (l *Localizer) TripUnknown() string {
+	return l.t("trip_unknown")
+}
+
+// Disruptions lists the disruptions on route (if any) from station, ds.
+func (l *Localizer) Disruptions(route, station string, ds []Disruption) string {
+	args := map[string]interface{}{"Route": route, "Station": station}
+	id := "disruptions"
+	if route != "" {
+		id = "disruptions_route"
+	}
+	if len(ds) == 0 {
+		return l.t(id+"_none", args)
+	}
+	headers := []string{}
+	for _, d := range ds {
+		headers = append(headers, strings.TrimRight(d.Header, "."))
+	}
+	args["Disruptions"] = strings.Join(headers, "; ")
+	return l.t(id, len(ds), args)
+}
+
+func (l *Localizer) windowDepartures(from, to string, start, end time.Time, deps []Departure, count int, r renderer) string {
+	args := map[string]interface{}{
+		"From":  r.station(from),
+		"To":    r.station(to),
+		"Start": r.time(start.In(l.tz).Format("15:04")),
+		"End":   r.time(end.In(l.tz).Format("15:04")),
+	}
+	id := "window_departures"
+	if to != "" {
+		id = "window_departures_to"
+	}
+	if count == 0 {
+		return l.t(id+"_none", args)
+	}
+	parts := l.departureParts(deps, r)
+	list := map[string]interface{}{
+		"Departures": r.join(parts[:len(parts)-1]),
+		"Last":       parts[len(parts)-1],
+	}
+	if len(parts) < count {
+		// "There are 12 departures ...; the first five are: ..."
+		return l.t(id, count, args) + " " + l.t("window_first", len(parts), list)
+	}
+	return l.t(id, count, args) + " " + l.t("window_all", len(parts), list)
+}
+
+// DeparturesTitle titles a table of departures.
+func (l *Localizer) DeparturesTitle(from, to string) string {
+	if to == "" {
+		return l.t("departures_from", map[string]interface{}{"From": from})
+	}
+	return l.t("departures_from_to", map[string]interface{}{"From": from, "To": to})
+}
+
+// DepartureColumns returns the column headers for a table of departures:
+// line, destination, time, delay and platform.
+func (l *Localizer) DepartureColumns() []string {
+	return []string{
+		l.t("column_line"),
+		l.t("column_destination"),
+		l.t("column_time"),
+		l.t("column_delay"),
+		l.t("column_platform"),
+	}
+}
+
+// ConnectionTimes summarizes when a connection departs and arrives.
+func (l *Localizer) ConnectionTimes(departing, arriving time.Time) string {
+	return l.t("connection_times", map[string]interface{}{
+		"Departure": departing.In(l.tz).Format("15:04"),
+		"Arrival":   arriving.In(l.tz).Format("15:04"),
+	})
+}
+
+// Leg briefly describes one leg of a connection, for display.
+func (l *Localizer) Leg(d Departure) string {
+	args := map[string]interface{}{
+		"Time":     d.Departing.In(l.tz).Format("15:04"),
+		"Name":     d.Name,
+		"From":     d.From,
+		"To":       d.To,
+		"Platform": d.Platform,
+	}
+	if d.Platform == "" {
+		return l.t("leg", args)
+	}
+	return l.t("leg_platform", args)
+}
+
+func (l *Localizer) OpenOnSearchCh() string {
+	return l.t("open_on_search_ch")
+}
+
+func (l *Localizer) SuggestMore() string {
+	return l.t("suggestion_more")
+}
+
+func (l *Localizer) SuggestTramsOnly() string {
+	return l.t("suggestion_trams_only")
+}
+
+func (l *Localizer) SuggestReturnTrip() string {
+	return l.t("suggestion_return_trip")
+}
+
+// placeName is the spoken name of a place like "home", or place itself if
+// we don't know it.
+func (l *Localizer) placeName(place string) string {
+	id := "place_" + strings.ToLower(place)
+	if n := l.t(id); n != id {
+		return n
+	}
+	return place
+}
+
+func (l *Localizer) PlaceSaved(place, station string) string {
+	return l.t("place_saved", map[string]interface{}{"Place": l.placeName(place), "Station": station})
+}
+
+func (l *Localizer) FavoriteSaved(station string) string {
+	return l.t("favorite_saved", map[string]interface{}{"Station": station})
+}
+
+// WhichStationToSave asks which station to save as place, or as a favorite
+// if place is empty.
+func (l *Localizer) WhichStationToSave(place string) string {
+	if place == "" {
+		return l.t("which_favorite")
+	}
+	return l.t("which_place", map[string]interface{}{"Place": l.placeName(place)})
+}
+
+func (l *Localizer) UnknownPlace(place string) string {
+	return l.t("unknown_place", map[string]interface{}{"Place": l.placeName(place)})
+}
+
+func (l *Localizer) UnknownTime(raw string) string {
+	return l.t("unknown_time", map[string]interface{}{"Time": raw})
+}
+
+// WhichStation asks which of options was meant by name.
+func (l *Localizer) WhichStation(name string, options []string) string {
+	return l.t("which_station", len(options), map[string]interface{}{
+		"Name":    name,
+		"Options": strings.Join(options[:len(options)-1], "; "),
+		"Last":    options[len(options)-1],
+	})
+}
+
+func (l *Localizer) WhichStationTitle(name string) string {
+	return l.t("which_station_title", map[string]interface{}{"Name": name})
+}
+
+func (l *Localizer) NoUser() string {
+	return l.t("no_user")
+}
+
+func (l *Localizer) CommuteSaved(from, to string) string {
+	if to == "" {
+		return l.t("commute_saved_from", map[string]interface{}{"From": from})
+	}
+	return l.t("commute_saved", map[string]interface{}{"From": from, "To": to})
+}
+
+func (l *Localizer) UnknownCommute() string {
+	return l.t("unknown_commute")
+}
+
+func (l *Localizer) alert(id string, d Departure) string {
+	return l.t(id, map[string]interface{}{
+		"Name":      d.Name,
+		"Time":      d.Departing.In(l.tz).Format("15:04"),
+		"From":      d.From,
+		"To":        d.To,
+		"Delay":     d.MinutesDelay,
+		"Platform":  d.Platform,
+		"Scheduled": d.ScheduledPlatform,
+	})
+}
+
+func (l *Localizer) AlertDelayed(d Departure) string {
+	return l.alert("alert_delayed", d)
+}
+
+func (l *Localizer) AlertCancelled(d Departure) string {
+	return l.alert("alert_cancelled", d)
+}
+
+func (l *Localizer) AlertPlatformChanged(d Departure) string {
+	if d.ScheduledPlatform != "" {
+		return l.alert("alert_platform_changed_instead", d)
+	}
+	return l.alert("alert_platform_changed", d)
+}
+
+func (l *Localizer) Subscribed(from, departs string) string {
+	return l.t("subscribed", map[string]interface{}{"From": from, "Time": departs})
+}
+
+// SubscriptionTimeNeeded asks when the journey to send alerts about leaves.
+func (l *Localizer) SubscriptionTimeNeeded() string {
+	return l.t("subscription_time_needed")
+}
+
+func (l *Localizer) Unsubscribed() string {
+	return l.t("unsubscribed")
+}
+
+// Leave says to leave in minutes to walk to station and catch d.
+func (l *Localizer) Leave(minutes int, station string, d Departure) string {
+	args := map[string]interface{}{
+		"Station": station,
+		"Name":    d.Name,
+		"To":      d.To,
+		"Time":    d.Departing.Add(time.Duration(d.MinutesDelay) * time.Minute).In(l.tz).Format("15:04"),
+	}
+	if minutes < 1 {
+		return l.t("leave_now", args)
+	}
+	return l.t("leave_in", minutes, args)
+}
+
+// LastConnection says when the last connection from from to to leaves
+// tonight, or that it's left if last is nil. It goes on to mention the night
+// connections after it, and the first connection of the morning if there
+// are none.
+func (l *Localizer) LastConnection(from, to string, last *Departure, night []Departure, supplement bool, first *Departure) string {
+	parts := []string{}
+	if last != nil {
+		parts = append(parts, l.t("last_connection", map[string]interface{}{
+			"From": from, "To": to, "Name": last.Name, "Time": last.Departing.In(l.tz).Format("15:04")}))
+	} else {
+		parts = append(parts, l.t("last_connection_gone", map[string]interface{}{"From": from, "To": to}))
+	}
+	if len(night) > 0 {
+		names, times := []string{}, []string{}
+		for _, d := range night {
+			if len(names) == 0 || names[len(names)-1] != d.Name {
+				names = append(names, d.Name)
+			}
+			times = append(times, d.Departing.In(l.tz).Format("15:04"))
+		}
+		// XXX: This string join is bad i18n, but it works.
+		parts = append(parts, l.t("night_connections", len(night), map[string]interface{}{
+			"Names": strings.Join(names, ", "), "Times": strings.Join(times, ", ")}))
+		if supplement {
+			parts = append(parts, l.t("night_supplement"))
+		}
+	} else if first != nil {
+		parts = append(parts, l.t("first_connection", map[string]interface{}{
+			"Name": first.Name, "Time": first.Departing.In(l.tz).Format("15:04")}))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Fare says how much a ticket from from to to costs, or that we don't know
+// if f is nil. discount is "half-fare" or "ga" for the traveller's card, or
+// empty to give both the full and half fare.
+func (l *Localizer) Fare(from, to string, f *Fare, discount string) string {
+	vars := map[string]interface{}{"From": from, "To": to}
+	if discount == "ga" {
+		return l.t("fare_ga", vars)
+	}
+	if f == nil {
+		return l.t("fare_unknown", vars)
+	}
+	vars["Full"], vars["Half"] = fmt.Sprintf("%.2f", f.Full), fmt.Sprintf("%.2f", f.Half)
+	parts := []string{}
+	if discount == "half-fare" {
+		parts = append(parts, l.t("fare_half", vars))
+	} else {
+		parts = append(parts, l.t("fare", vars))
+	}
+	if f.Network != "" {
+		parts = append(parts, l.t("fare_zones", f.Zones, map[string]interface{}{"Network": f.Network}))
+	}
+	return strings.Join(parts, " ")
+}
@@ -1,8 +1,11 @@
 package localize
 
 import (
+	"strings"
 	"testing"
 	"time"
+
+	"modes"
 )
 
 func TestNeedLocation(t *testing.T) {
@@ -78,13 +81,13 @@ func TestDepatures(t *testing.T) {
 	for l, wants := range map[string][]departuresTest{
 		"en": []departuresTest{
 			{"Zurich", "", time.Time{}, []Departure{}, "I could not find any matching routes."},
-			{"Zurich", "", time.Time{}, []Departure{{"S7", 0, "Zurich", "Enge", time.Unix(1517055015, 0), "bus", ""}},
+			{"Zurich", "", time.Time{}, []Departure{{Name: "S7", MinutesDelay: 0, From: "Zurich", To: "Enge", Departing: time.Unix(1517055015, 0), Mode: "bus", Platform: ""}},
 				"The next departure from Zurich is: the S7 bus departing on-time at 12:10 to Enge."},
-			{"Zurich", "", time.Unix(1517055015, 0), []Departure{{"S7", 0, "Zurich", "Enge", time.Unix(1517055015, 0), "bus", ""}},
+			{"Zurich", "", time.Unix(1517055015, 0), []Departure{{Name: "S7", MinutesDelay: 0, From: "Zurich", To: "Enge", Departing: time.Unix(1517055015, 0), Mode: "bus", Platform: ""}},
 				"The next departure leaving Zurich from 12:10 is: the S7 bus departing on-time at 12:10 to Enge."},
-			{"Zurich", "", time.Time{}, []Departure{{"S7", 2, "Zurich", "Enge", time.Unix(1517055015, 0), "bus", ""}, {"S8", 0, "Zurich", "Basel", time.Unix(1517055015, 0), "train", "6"}},
+			{"Zurich", "", time.Time{}, []Departure{{Name: "S7", MinutesDelay: 2, From: "Zurich", To: "Enge", Departing: time.Unix(1517055015, 0), Mode: "bus", Platform: ""}, {Name: "S8", MinutesDelay: 0, From: "Zurich", To: "Basel", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "6"}},
 				"The next 2 departures from Zurich are: the S7 bus departing at 12:10 with a 2-minute delay to Enge, and the S8 train departing on-time from platform 6 at 12:10 to Basel."},
-			{"Zurich", "", time.Unix(1517055015, 0), []Departure{{"S7", 0, "Zurich", "Enge", time.Unix(1517055015, 0), "bus", ""}, {"S8", 0, "Zurich", "Basel", time.Unix(1517055015, 0), "train", ""}},
+			{"Zurich", "", time.Unix(1517055015, 0), []Departure{{Name: "S7", MinutesDelay: 0, From: "Zurich", To: "Enge", Departing: time.Unix(1517055015, 0), Mode: "bus", Platform: ""}, {Name: "S8", MinutesDelay: 0, From: "Zurich", To: "Basel", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: ""}},
 				"The next 2 departures leaving Zurich from 12:10 are: the S7 bus departing on-time at 12:10 to Enge, and the S8 train departing on-time at 12:10 to Basel."},
 		},
 		"de": []departuresTest{},
@@ -98,3 +101,283 @@ func TestDepatures(t *testing.T) {
 		}
 	}
 }
+
+func TestLeg(t *testing.T) {
+	for l, want := range map[string][]string{
+		"en": {"12:10 S7 from Zurich to Enge", "12:10 S8 from Zurich, platform 6, to Basel"},
+		"de": {"12:10 S7 von Zurich nach Enge", "12:10 S8 von Zurich, Gleis 6, nach Basel"},
+	} {
+		l := NewLocalizer(l, time.UTC)
+		for i, d := range []Departure{
+			{Name: "S7", From: "Zurich", To: "Enge", Departing: time.Unix(1517055015, 0), Mode: "train"},
+			{Name: "S8", From: "Zurich", To: "Basel", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "6"},
+		} {
+			if got := l.Leg(d); got != want[i] {
+				t.Errorf("want '%v', got '%v'", want[i], got)
+			}
+		}
+	}
+}
+
+func TestNextDeparturesSSML(t *testing.T) {
+	deps := []Departure{
+		{Name: "S12", From: "Zürich HB", To: "Winterthur", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "3"},
+		{Name: "IC5", From: "Zürich HB", To: "Lausanne", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "16", MinutesDelay: 2},
+		{Name: "4", From: "Zürich HB", To: "Tiefenbrunnen", Departing: time.Unix(1517055015, 0), Mode: "tram"},
+	}
+	l := NewLocalizer("de", time.UTC)
+	want := `<speak>Die nächste 3 Abfarten von Zürich <sub alias="Hauptbahnhof">HB</sub> sind: ` +
+		`der <say-as interpret-as="characters">S</say-as> <say-as interpret-as="cardinal">12</say-as> Zug pünktlich abfahren ` +
+		`von Gleis <say-as interpret-as="cardinal">3</say-as> nach Winterthur um <say-as interpret-as="time" format="hms24">12:10</say-as>;` +
+		`<break time="400ms"/> der <sub alias="Intercity">IC</sub> <say-as interpret-as="cardinal">5</say-as> Zug abfahren ` +
+		`von Gleis <say-as interpret-as="cardinal">16</say-as> mit einer 2 Minuten Verspätung nach <lang xml:lang="fr-CH">Lausanne</lang> ` +
+		`um <say-as interpret-as="time" format="hms24">12:10</say-as>, und `
+	got := l.NextDeparturesSSML("Zürich HB", "", time.Time{}, deps)
+	if !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "</speak>") {
+		t.Errorf("want '%v...</speak>', got '%v'", want, got)
+	}
+}
+
+func TestMode(t *testing.T) {
+	for lang, want := range map[string]string{
+		"en": "the 1 funicular departing on-time at 12:10 to Polyterrasse; boats",
+		"de": "die 1 Standseilbahn pünktlich abfahren nach Polyterrasse um 12:10; Schiffe",
+		"fr": "le funiculaire 1 à destination de Polyterrasse part à l'heure à 12:10; bateaux",
+	} {
+		l := NewLocalizer(lang, time.UTC)
+		parts := l.departureParts([]Departure{{Name: "1", To: "Polyterrasse", Departing: time.Unix(1517055015, 0), Mode: modes.Funicular}}, plainText{})
+		if got := strings.Join(append(parts, l.Mode(modes.Ship, 2)), "; "); got != want {
+			t.Errorf("%v: want '%v', got '%v'", lang, want, got)
+		}
+	}
+}
+
+func TestPlatformChanged(t *testing.T) {
+	deps := []Departure{
+		{Name: "S12", To: "Winterthur", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "7", PlatformChanged: true, ScheduledPlatform: "5"},
+		{Name: "S8", To: "Pfäffikon SZ", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "4", PlatformChanged: true},
+	}
+	for lang, want := range map[string]string{
+		"en": "the S12 train departing on-time at 12:10 to Winterthur, now leaving from platform 7 instead of 5; " +
+			"the S8 train departing on-time at 12:10 to Pfäffikon SZ, now leaving from platform 4",
+		"de": "der S12 Zug pünktlich abfahren nach Winterthur um 12:10, heute ab Gleis 7 statt 5; " +
+			"der S8 Zug pünktlich abfahren nach Pfäffikon SZ um 12:10, heute ab Gleis 4",
+	} {
+		l := NewLocalizer(lang, time.UTC)
+		if got := strings.Join(l.departureParts(deps, plainText{}), "; "); got != want {
+			t.Errorf("%v: want '%v', got '%v'", lang, want, got)
+		}
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	// A cancelled departure's delay is 0, which isn't on time.
+	deps := []Departure{{Name: "S12", To: "Winterthur", Departing: time.Unix(1517055015, 0), Mode: "train", Platform: "7", Cancelled: true}}
+	for lang, want := range map[string]string{
+		"en": "the S12 train at 12:10 to Winterthur is cancelled",
+		"de": "der S12 Zug nach Winterthur um 12:10 fällt aus",
+		"fr": "ne circule pas",
+	} {
+		l := NewLocalizer(lang, time.UTC)
+		if got := strings.Join(l.departureParts(deps, plainText{}), "; "); !strings.HasSuffix(got, want) {
+			t.Errorf("%v: want '...%v', got '%v'", lang, want, got)
+		}
+	}
+}
+
+func TestDisruptions(t *testing.T) {
+	works := Disruption{ID: "d1", Header: "Winterthur - Effretikon: construction work."}
+	l := NewLocalizer("en", time.UTC)
+	deps := []Departure{
+		{Name: "S8", From: "Stadelhofen", To: "Winterthur", Departing: time.Unix(1517055015, 0), Mode: "train", Disruptions: []Disruption{works}},
+		{Name: "S8", From: "Stadelhofen", To: "Winterthur", Departing: time.Unix(1517055915, 0), Mode: "train", Disruptions: []Disruption{works}},
+	}
+	if got, want := l.NextDepartures("Stadelhofen", "", time.Time{}, deps), "Please note: Winterthur - Effretikon: construction work."; !strings.HasSuffix(got, want) {
+		t.Errorf("want '...%v', got '%v'", want, got)
+	}
+	if got := l.NextDeparturesSSML("Stadelhofen", "", time.Time{}, deps); !strings.HasSuffix(got, "construction work.</speak>") {
+		t.Errorf("want the note in the SSML, got '%v'", got)
+	}
+
+	for _, tc := range []struct {
+		lang, route string
+		ds          []Disruption
+		want        string
+	}{
+		{"en", "S8", nil, "I don't know of any disruptions on the S8 from Stadelhofen."},
+		{"en", "S8", []Disruption{works}, "There is one disruption on the S8 from Stadelhofen: Winterthur - Effretikon: construction work."},
+		{"de", "", []Disruption{works, {ID: "d2", Header: "Aufzug defekt"}}, "In Stadelhofen gibt es 2 Störungen: Winterthur - Effretikon: construction work; Aufzug defekt."},
+	} {
+		l := NewLocalizer(tc.lang, time.UTC)
+		if got := l.Disruptions(tc.route, "Stadelhofen", tc.ds); got != tc.want {
+			t.Errorf("want '%v', got '%v'", tc.want, got)
+		}
+	}
+}
+
+func TestStopsAt(t *testing.T) {
+	uster := Stop{Name: "Uster", Arriving: time.Date(2018, time.March, 5, 12, 19, 0, 0, time.UTC)}
+	d := Departure{Name: "S5", To: "Pfäffikon SZ", Departing: time.Date(2018, time.March, 5, 12, 4, 0, 0, time.UTC), Stops: []Stop{uster}}
+	l := NewLocalizer("en", time.UTC)
+	if got, want := l.StopsAt(d, "uster", &uster), "Yes, the S5 at 12:04 to Pfäffikon SZ stops in Uster at 12:19."; got != want {
+		t.Errorf("want '%v', got '%v'", want, got)
+	}
+	if got, want := l.ArrivesAt(d, "Winterthur", nil), "The S5 at 12:04 to Pfäffikon SZ doesn't stop in Winterthur."; got != want {
+		t.Errorf("want '%v', got '%v'", want, got)
+	}
+	d.Stops = nil
+	if got, want := l.StopsAt(d, "Uster", nil), "Sorry, I don't know where the S5 at 12:04 to Pfäffikon SZ stops."; got != want {
+		t.Errorf("want '%v', got '%v'", want, got)
+	}
+}
+
+func TestTripPosition(t *testing.T) {
+	at := func(hh, mm int) time.Time { return time.Date(2018, time.March, 5, hh, mm, 0, 0, time.UTC) }
+	zurich := Stop{Name: "Zürich HB", Departing: at(12, 2)}
+	aarau := Stop{Name: "Aarau", Arriving: at(12, 27), Departing: at(12, 29), MinutesDelay: 3}
+	d := Departure{Name: "IC5", To: "Lausanne"}
+	for _, tc := range []struct {
+		lang       string
+		last, next *Stop
+		want       string
+	}{
+		{"en", nil, &zurich, "The IC5 to Lausanne hasn't left Zürich HB yet. It leaves at 12:02."},
+		{"en", &zurich, &aarau, "The IC5 to Lausanne left Zürich HB at 12:02 and arrives in Aarau at 12:30."},
+		{"de", &aarau, &aarau, "Der IC5 nach Lausanne steht in Aarau und fährt um 12:32 weiter."},
+		{"fr", &aarau, nil, "Le IC5 est arrivé à Aarau à 12:30."},
+		{"en", nil, nil, "Sorry, I can't follow that trip. Please ask about its departure again."},
+	} {
+		l := NewLocalizer(tc.lang, time.UTC)
+		if got := l.TripPosition(d, tc.last, tc.next); got != tc.want {
+			t.Errorf("want '%v', got '%v'", tc.want, got)
+		}
+	}
+}
+
+func TestVehiclePosition(t *testing.T) {
+	central, bellevue := Stop{Name: "Central"}, Stop{Name: "Bellevue"}
+	d := Departure{Name: "15", From: "Bucheggplatz"}
+	for _, tc := range []struct {
+		lang string
+		pos  *Position
+		want string
+	}{
+		{"en", &Position{Last: &central, Next: &bellevue, StopsAway: 3, Minutes: 8}, "The 15 from Bucheggplatz is between Central and Bellevue, 3 stops away, about 8 minutes."},
+		{"en", &Position{Last: &bellevue, Next: &bellevue, StopsAway: 1, Minutes: 1}, "The 15 from Bucheggplatz is at Bellevue, 1 stop away, about 1 minute."},
+		{"de", &Position{Next: &central, StopsAway: 4, Minutes: 12}, "Der 15 ist noch nicht in Central abgefahren. Er ist 4 Haltestellen entfernt, etwa 12 Minuten."},
+		{"fr", &Position{Last: &bellevue, Next: &bellevue}, "Le 15 de Bucheggplatz est à Stadelhofen maintenant."},
+		{"en", nil, "Sorry, I don't know where the next one to Stadelhofen is."},
+	} {
+		l := NewLocalizer(tc.lang, time.UTC)
+		if got := l.VehiclePosition(d, "Stadelhofen", tc.pos); got != tc.want {
+			t.Errorf("want '%v', got '%v'", tc.want, got)
+		}
+	}
+}
+
+func TestStepFree(t *testing.T) {
+	l := NewLocalizer("en", time.UTC)
+	deps := []Departure{{Name: "15", From: "Stadelhofen", To: "Klusplatz", Departing: time.Unix(1517055015, 0), Mode: "tram", StepFree: true}}
+	if got, want := l.NextDepartures("Stadelhofen", "", time.Time{}, deps), "to Klusplatz, step-free."; !strings.HasSuffix(got, want) {
+		t.Errorf("want '...%v', got '%v'", want, got)
+	}
+}
+
+func TestVeryBusy(t *testing.T) {
+	d := Departure{Name: "IC1", From: "Zürich HB", To: "Basel SBB", Departing: time.Unix(1517055015, 0), Mode: "train", Occupancy1st: OccupancyMedium, Occupancy2nd: OccupancyHigh}
+	for _, tc := range []struct{ lang, want string }{
+		{"en", "to Basel SBB, expected to be very busy in 2nd class."},
+		{"de", "in der 2. Klasse voraussichtlich sehr stark ausgelastet."},
+	} {
+		l := NewLocalizer(tc.lang, time.UTC)
+		if got := l.NextDepartures("Zürich HB", "", time.Time{}, []Departure{d}); !strings.HasSuffix(got, tc.want) {
+			t.Errorf("want '...%v', got '%v'", tc.want, got)
+		}
+	}
+}
+
+func TestLooksFrench(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Genève":             true,
+		"Lausanne":           true,
+		"Fribourg/Freiburg":  false,
+		"Neuchâtel":          true,
+		"La Chaux-de-Fonds":  true,
+		"Yverdon-les-Bains":  true,
+		"Zürich HB":          false,
+		"Bern, Bahnhofplatz": false,
+		"Biel/Bienne, Gare":  true,
+		"Winterthur":         false,
+	} {
+		if got := looksFrench(name); got != want {
+			t.Errorf("%v: want %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestPlaceSaved(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	l := NewLocalizer("de", tz)
+	if got, want := l.PlaceSaved("home", "Stadelhofen"), "Alles klar, Stadelhofen ist als Zuhause gespeichert."; got != want {
+		t.Errorf("want '%v', got '%v'", want, got)
+	}
+	// Places we don't have a name for are spoken as they are.
+	if got, want := l.PlaceSaved("gym", "Hardbrücke"), "Alles klar, Hardbrücke ist als gym gespeichert."; got != want {
+		t.Errorf("want '%v', got '%v'", want, got)
+	}
+	if got, want := l.WhichStationToSave("home"), "Welche Haltestelle soll ich als Zuhause speichern?"; !strings.HasPrefix(got, want) {
+		t.Errorf("want '%v...', got '%v'", want, got)
+	}
+}
+
+func TestWindowDepartures(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	l := NewLocalizer("en", tz)
+	at := func(hour, min int) time.Time {
+		return time.Date(2018, time.March, 5, hour, min, 0, 0, tz)
+	}
+	deps := []Departure{
+		{Name: "S9", Mode: "train", To: "Uster", Departing: at(17, 0)},
+		{Name: "S5", Mode: "train", To: "Pfäffikon SZ", Departing: at(17, 10)},
+	}
+	for _, tc := range []struct {
+		deps  []Departure
+		count int
+		want  string
+	}{
+		{deps, 12, "There are 12 departures from Stadelhofen between 17:00 and 18:00. The first 2 are: the S9 train departing on-time at 17:00 to Uster, and the S5 train departing on-time at 17:10 to Pfäffikon SZ."},
+		{deps, 2, "There are 2 departures from Stadelhofen between 17:00 and 18:00. They are: the S9 train departing on-time at 17:00 to Uster, and the S5 train departing on-time at 17:10 to Pfäffikon SZ."},
+		{deps[:1], 1, "There is one departure from Stadelhofen between 17:00 and 18:00. It's the S9 train departing on-time at 17:00 to Uster."},
+		{nil, 0, "There are no departures from Stadelhofen between 17:00 and 18:00."},
+	} {
+		if got := l.WindowDepartures("Stadelhofen", "", at(17, 0), at(18, 0), tc.deps, tc.count); got != tc.want {
+			t.Errorf("want '%v', got '%v'", tc.want, got)
+		}
+	}
+}
+
+func TestFare(t *testing.T) {
+	zvv := &Fare{Full: 9.2, Half: 6.4, Network: "ZVV", Zones: 4}
+	for _, tc := range []struct {
+		lang, discount string
+		f              *Fare
+		want           string
+	}{
+		{"en", "", zvv, "A 2nd class ticket from Zürich HB to Uster costs CHF 9.20, or CHF 6.40 with a half-fare card. That's the ZVV fare for 4 zones."},
+		{"en", "half-fare", &Fare{Full: 51, Half: 25.5}, "With a half-fare card, a 2nd class ticket from Zürich HB to Uster costs CHF 25.50."},
+		{"en", "ga", nil, "Your GA travelcard covers the trip from Zürich HB to Uster, so you don't need a ticket."},
+		{"de", "", nil, "Leider weiss ich nicht, wie viel ein Billett von Zürich HB nach Uster kostet. Ich kenne nur die Preise innerhalb von Zonenverbünden wie dem ZVV."},
+		{"de", "half-fare", zvv, "Mit dem Halbtax kostet ein Billett 2. Klasse von Zürich HB nach Uster CHF 6.40. Das ist der ZVV-Tarif für 4 Zonen."},
+	} {
+		l := NewLocalizer(tc.lang, time.UTC)
+		if got := l.Fare("Zürich HB", "Uster", tc.f, tc.discount); got != tc.want {
+			t.Errorf("want '%v', got '%v'", tc.want, got)
+		}
+	}
+}
+
+func TestLoaded(t *testing.T) {
+	if err := Loaded(); err != nil {
+		t.Errorf("want every language loaded from ./data, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package localize
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A renderer formats the variable parts of a sentence: plain text for
+// display, or SSML for speech.
+type renderer interface {
+	station(name string) string
+	line(name string) string
+	time(hhmm string) string
+	platform(p string) string
+	// join joins all but the last of a list of departures.
+	join(parts []string) string
+	// text is any other text, e.g. a disruption message.
+	text(s string) string
+}
+
+type plainText struct{}
+
+func (plainText) station(name string) string { return name }
+func (plainText) line(name string) string    { return name }
+func (plainText) time(hhmm string) string    { return hhmm }
+func (plainText) platform(p string) string   { return p }
+func (plainText) join(parts []string) string { return strings.Join(parts, "; ") }
+func (plainText) text(s string) string       { return s }
+
+// pause is inserted between departures in SSML.
+const pause = `<break time="400ms"/>`
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+// lexicon gives pronunciations for abbreviations in station names and line
+// codes, by language. An empty alias means the abbreviation is spelled out.
+var lexicon = map[string]map[string]string{
+	"HB":  {"de": "Hauptbahnhof", "en": "", "fr": ""},
+	"Hbf": {"de": "Hauptbahnhof", "en": "", "fr": ""},
+	"Bhf": {"de": "Bahnhof", "en": "station", "fr": "gare"},
+	"Bf":  {"de": "Bahnhof", "en": "station", "fr": "gare"},
+	"SBB": {"de": "", "en": "", "fr": ""},
+	"CFF": {"de": "", "en": "", "fr": ""},
+	"FFS": {"de": "", "en": "", "fr": ""},
+	"IC":  {"de": "Intercity", "en": "Intercity", "fr": "Intercity"},
+	"ICN": {"de": "Intercity-Neigezug", "en": "", "fr": ""},
+	"IR":  {"de": "Interregio", "en": "InterRegio", "fr": "InterRegio"},
+	"EC":  {"de": "Eurocity", "en": "EuroCity", "fr": "EuroCity"},
+	"ICE": {"de": "", "en": "", "fr": ""},
+	"RE":  {"de": "Regio-Express", "en": "RegioExpress", "fr": "RegioExpress"},
+}
+
+var lineCode = regexp.MustCompile(`^([A-Z]*)\s*(\d*)$`)
+
+// frenchPlaces are French-speaking places whose names don't otherwise look
+// French.
+var frenchPlaces = map[string]bool{
+	"lausanne": true, "sion": true, "nyon": true, "morges": true,
+	"vevey": true, "montreux": true, "yverdon-les-bains": true, "renens": true,
+	"bulle": true, "martigny": true, "monthey": true, "aigle": true,
+	"porrentruy": true, "carouge": true, "cornavin": true,
+}
+
+// frenchWords are words which, in a station name, suggest it's French.
+var frenchWords = map[string]bool{
+	"gare": true, "place": true, "rue": true, "pont": true, "ville": true,
+	"saint": true, "sainte": true, "les": true, "la": true,
+	"le": true, "du": true, "des": true, "avenue": true, "chemin": true,
+	"route": true, "centre": true, "grand": true, "gd": true,
+}
+
+// looksFrench guesses whether a station name is French, so it can be
+// pronounced as such in other languages.
+func looksFrench(name string) bool {
+	if strings.ContainsAny(name, "éèêëàâçôîûÉÈ") {
+		return true
+	}
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+	for i, w := range words {
+		if frenchWords[w] || (i == 0 && frenchPlaces[w]) {
+			return true
+		}
+		for _, p := range strings.Split(w, "-") {
+			if frenchWords[p] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ssml struct {
+	lang string
+}
+
+// abbreviation renders a lexicon entry, or "" if word isn't one.
+func (s ssml) abbreviation(word, lang string) string {
+	aliases, ok := lexicon[word]
+	if !ok {
+		return ""
+	}
+	if alias := aliases[lang]; alias != "" {
+		return `<sub alias="` + escaper.Replace(alias) + `">` + escaper.Replace(word) + `</sub>`
+	}
+	return `<say-as interpret-as="characters">` + escaper.Replace(word) + `</say-as>`
+}
+
+func (s ssml) station(name string) string {
+	lang := s.lang
+	french := lang != "fr" && looksFrench(name)
+	if french {
+		lang = "fr"
+	}
+	words := strings.Split(name, " ")
+	for i, w := range words {
+		// Keep trailing punctuation, e.g. "HB," outside the tag.
+		trimmed := strings.TrimRight(w, ",;.")
+		if a := s.abbreviation(trimmed, lang); a != "" {
+			words[i] = a + escaper.Replace(w[len(trimmed):])
+		} else {
+			words[i] = escaper.Replace(w)
+		}
+	}
+	r := strings.Join(words, " ")
+	if french {
+		return `<lang xml:lang="fr-CH">` + r + `</lang>`
+	}
+	return r
+}
+
+func (s ssml) line(name string) string {
+	m := lineCode.FindStringSubmatch(name)
+	if m == nil || name == "" {
+		return escaper.Replace(name)
+	}
+	prefix, number := m[1], m[2]
+	r := s.abbreviation(prefix, s.lang)
+	if r == "" && prefix != "" {
+		// E.g. "S" in "S12", or "T".
+		r = `<say-as interpret-as="characters">` + prefix + `</say-as>`
+	}
+	if number != "" {
+		if r != "" {
+			r += " "
+		}
+		r += `<say-as interpret-as="cardinal">` + number + `</say-as>`
+	}
+	return r
+}
+
+func (s ssml) time(hhmm string) string {
+	return `<say-as interpret-as="time" format="hms24">` + escaper.Replace(hhmm) + `</say-as>`
+}
+
+func (s ssml) platform(p string) string {
+	for _, r := range p {
+		if !unicode.IsDigit(r) {
+			// E.g. "3AB" or "D".
+			return `<say-as interpret-as="characters">` + escaper.Replace(p) + `</say-as>`
+		}
+	}
+	return `<say-as interpret-as="cardinal">` + p + `</say-as>`
+}
+
+func (s ssml) join(parts []string) string {
+	return strings.Join(parts, ";"+pause+" ")
+}
+
+func (s ssml) text(t string) string {
+	return escaper.Replace(t)
+}
+
+// NextDeparturesSSML is like NextDepartures, but returns SSML with
+// pronunciation hints for times, platforms, line codes and station names.
+func (l *Localizer) NextDeparturesSSML(from, to string, startTime time.Time, deps []Departure) string {
+	b, _ := l.lang.Base()
+	r := ssml{b.String()}
+	return "<speak>" + l.withDisruptions(l.nextDepartures(from, to, startTime, deps, r), deps, r) + "</speak>"
+}
+
+// WindowDeparturesSSML is like WindowDepartures, but returns SSML.
+func (l *Localizer) WindowDeparturesSSML(from, to string, start, end time.Time, deps []Departure, count int) string {
+	b, _ := l.lang.Base()
+	r := ssml{b.String()}
+	return "<speak>" + l.withDisruptions(l.windowDepartures(from, to, start, end, deps, count, r), deps, r) + "</speak>"
+}
@@ -0,0 +1,112 @@
+// Package modes is the modes of transport, shared by the timetable
+// queries, the gazetteer and the localized replies.
+package modes
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Mode of transport. Its value is what the JSON API and the Dialogflow
+// transport entity use.
+type Mode string
+
+const (
+	// Unknown is a mode we don't know. Only an empty Set matches it, so
+	// asking for trams leaves out departures we can't tell are trams.
+	Unknown   Mode = ""
+	Train     Mode = "train"
+	Tram      Mode = "tram"
+	Bus       Mode = "bus"
+	Metro     Mode = "metro"
+	Ship      Mode = "ship"
+	Funicular Mode = "funicular"
+	// Cableway is cable cars, gondolas and chairlifts.
+	Cableway Mode = "cableway"
+	Walk     Mode = "walk"
+)
+
+// All is every known mode one can depart with, in the order they're
+// listed.
+var All = []Mode{Train, Tram, Bus, Metro, Ship, Funicular, Cableway}
+
+// categories maps the search.ch types and the opendata.ch categories,
+// lower-cased, to modes.
+var categories = map[string]Mode{
+	// search.ch
+	"strain": Train, "express_train": Train, "train": Train, "tram": Tram,
+	"bus": Bus, "post": Bus, "night_bus": Bus, "metro": Metro,
+	"ship": Ship, "funicular": Funicular, "cablecar": Cableway, "gondola": Cableway,
+	"chairlift": Cableway, "walk": Walk,
+	// opendata.ch
+	"s": Train, "sn": Train, "r": Train, "re": Train, "ir": Train, "ic": Train, "ice": Train,
+	"icn": Train, "ec": Train, "en": Train, "tgv": Train, "ire": Train, "pe": Train, "rj": Train,
+	"t": Tram, "ntr": Tram, "b": Bus, "nfb": Bus, "kb": Bus, "nb": Bus, "m": Metro,
+	"bat": Ship, "fae": Ship, "fun": Funicular, "pb": Cableway, "gb": Cableway, "sl": Cableway,
+	"lb": Cableway, "asc": Cableway,
+}
+
+// FromCategory returns the mode of a search.ch type, e.g. "strain", or an
+// opendata.ch category, e.g. "IC" or "BAT".
+func FromCategory(category string) Mode {
+	return categories[strings.ToLower(strings.TrimSpace(category))]
+}
+
+// routeTypes maps GTFS route types, basic and extended, to modes. The
+// extended types are mapped by hundreds.
+var routeTypes = map[int]Mode{
+	0: Tram, 1: Metro, 2: Train, 3: Bus, 4: Ship, 5: Tram, 6: Cableway, 7: Funicular, 11: Bus, 12: Train,
+	100: Train, 200: Bus, 400: Metro, 700: Bus, 800: Bus, 900: Tram, 1000: Ship, 1200: Ship,
+	1300: Cableway, 1400: Funicular,
+}
+
+// FromRouteType returns the mode of a GTFS route_type, e.g. "3" or "700".
+func FromRouteType(raw string) Mode {
+	t, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return Unknown
+	}
+	if m, ok := routeTypes[t]; ok {
+		return m
+	}
+	return routeTypes[t/100*100]
+}
+
+// words maps what people call a mode, and the transport entity's values,
+// to modes.
+var words = map[string]Mode{
+	"train": Train, "trains": Train, "zug": Train, "züge": Train, "bahn": Train, "s-bahn": Train,
+	"tram": Tram, "trams": Tram, "tramway": Tram, "straßenbahn": Tram,
+	"bus": Bus, "busses": Bus, "buses": Bus, "busse": Bus, "trolleybus": Bus, "postauto": Bus,
+	"metro": Metro, "subway": Metro,
+	"ship": Ship, "boat": Ship, "boats": Ship, "schiff": Ship, "boot": Ship, "bateau": Ship,
+	"funicular": Funicular, "standseilbahn": Funicular, "funiculaire": Funicular,
+	"cableway": Cableway, "cable car": Cableway, "gondola": Cableway, "seilbahn": Cableway,
+	"luftseilbahn": Cableway, "téléphérique": Cableway,
+}
+
+// Parse returns the mode named by s, e.g. "boat" or "Zug". It returns
+// Unknown for "any", which is the transport entity's default.
+func Parse(s string) Mode {
+	return words[strings.ToLower(strings.TrimSpace(s))]
+}
+
+// A Set of modes. The empty set matches every mode.
+type Set map[Mode]bool
+
+// NewSet returns the set of modes named in names, ignoring those which
+// aren't known, like "any".
+func NewSet(names []string) Set {
+	s := Set{}
+	for _, n := range names {
+		if m := Parse(n); m != Unknown {
+			s[m] = true
+		}
+	}
+	return s
+}
+
+// Match returns whether m is one of s, or s is empty.
+func (s Set) Match(m Mode) bool {
+	return len(s) == 0 || s[m]
+}
@@ -0,0 +1,39 @@
+package modes
+
+import "testing"
+
+func TestFromCategory(t *testing.T) {
+	for category, want := range map[string]Mode{
+		"strain": Train, "express_train": Train, "IC": Train, "post": Bus, "NFB": Bus,
+		"tram": Tram, "BAT": Ship, "ship": Ship, "funicular": Funicular, "gondola": Cableway,
+		"M": Metro, "spaceship": Unknown,
+	} {
+		if got := FromCategory(category); got != want {
+			t.Errorf("%q: want %q, got %q", category, want, got)
+		}
+	}
+}
+
+func TestFromRouteType(t *testing.T) {
+	for raw, want := range map[string]Mode{
+		"0": Tram, "3": Bus, "7": Funicular, "109": Train, "700": Bus, "705": Bus,
+		"900": Tram, "1000": Ship, "1300": Cableway, "1400": Funicular, "x": Unknown, "1700": Unknown,
+	} {
+		if got := FromRouteType(raw); got != want {
+			t.Errorf("%q: want %q, got %q", raw, want, got)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	if s := NewSet([]string{"any"}); !s.Match(Bus) || !s.Match(Unknown) {
+		t.Errorf("want any to match everything, got %v", s)
+	}
+	s := NewSet([]string{"boat", "Zug"})
+	if !s.Match(Ship) || !s.Match(Train) || s.Match(Bus) {
+		t.Errorf("want ships and trains, got %v", s)
+	}
+	if s.Match(Unknown) {
+		t.Errorf("want unknown modes left out of a filter, got %v", s)
+	}
+}
@@ -0,0 +1,120 @@
+package query
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"localize"
+	"transport"
+)
+
+// timerangeLayouts are the ways the API gives the ends of a disruption's
+// time range.
+var timerangeLayouts = []string{"02.01.2006 15:04", "02.01.2006", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTimerange parses a range like "20.10.2026 05:00 - 25.10.2026
+// 23:59". Ends it can't parse are zero, meaning open.
+func parseTimerange(raw string, tz *time.Location) (start, end time.Time) {
+	parts := strings.SplitN(raw, " - ", 2)
+	parse := func(s string, endOfDay bool) time.Time {
+		s = strings.TrimSpace(s)
+		for _, layout := range timerangeLayouts {
+			if t, err := time.ParseInLocation(layout, s, tz); err == nil {
+				if endOfDay && !strings.Contains(layout, "15") {
+					t = t.AddDate(0, 0, 1).Add(-1 * time.Minute)
+				}
+				return t
+			}
+		}
+		return time.Time{}
+	}
+	start = parse(parts[0], false)
+	if len(parts) == 2 {
+		end = parse(parts[1], true)
+	}
+	return start, end
+}
+
+// disruptions converts the disruptions of a departure of line, most
+// important first.
+func disruptions(ds transport.Disruptions, line string, tz *time.Location) []localize.Disruption {
+	if len(ds) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(ds))
+	for id := range ds {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if a, b := ds[ids[i]].Priority, ds[ids[j]].Priority; a != b {
+			return a > b
+		}
+		return ids[i] < ids[j]
+	})
+	r := []localize.Disruption{}
+	for _, id := range ids {
+		d := ds[id]
+		x := localize.Disruption{ID: id, Header: strings.TrimSpace(d.Header), Text: strings.TrimSpace(d.Text)}
+		if x.Header == "" {
+			x.Header = strings.TrimSpace(d.Lead)
+		}
+		if x.Header == "" {
+			continue
+		}
+		x.Start, x.End = parseTimerange(d.Timerange, tz)
+		if line != "" {
+			x.Lines = []string{line}
+		}
+		r = append(r, x)
+	}
+	return r
+}
+
+// Active returns whether d applies at t, as far as we know.
+func Active(d localize.Disruption, t time.Time) bool {
+	return (d.Start.IsZero() || !t.Before(d.Start)) && (d.End.IsZero() || !t.After(d.End))
+}
+
+// Disruptions returns the disruptions now affecting departures from
+// p.Source matching p's modes and routes, with the lines they affect.
+func Disruptions(svc transport.Transport, p Params, tz *time.Location, now time.Time) ([]localize.Disruption, error) {
+	if p.Datetime.IsZero() {
+		p.Datetime = now
+	}
+	departures, err := stationboard(svc, p, tz)
+	if err != nil {
+		return nil, err
+	}
+	f := newFilter(p)
+	ds := []localize.Disruption{}
+	byID := map[string]int{}
+	for _, d := range departures {
+		if !f.match(d) {
+			continue
+		}
+		for _, x := range d.Disruptions {
+			if !Active(x, now) {
+				continue
+			}
+			if i, ok := byID[x.ID]; ok {
+				if !contains(ds[i].Lines, d.Name) {
+					ds[i].Lines = append(ds[i].Lines, d.Name)
+				}
+				continue
+			}
+			byID[x.ID] = len(ds)
+			ds = append(ds, x)
+		}
+	}
+	return ds, nil
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
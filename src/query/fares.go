@@ -0,0 +1,54 @@
+package query
+
+import (
+	"math"
+	"time"
+
+	"fares"
+	"localize"
+	"modes"
+	"transport"
+)
+
+// Fare prices a ticket for the next connection matching p. It returns nil
+// if there's no such connection or Price can't price it.
+func Fare(svc transport.Transport, p Params, tariffs *fares.Tariffs, tz *time.Location) (*localize.Fare, error) {
+	conns, err := Connections(svc, p, tz)
+	if err != nil || len(conns) == 0 {
+		return nil, err
+	}
+	return Price(conns[0], tariffs), nil
+}
+
+// Price prices a ticket for c: at the provider's price if it gives one, or
+// else at the zone fare in tariffs, which may be nil. It returns nil if
+// neither knows.
+func Price(c Connection, tariffs *fares.Tariffs) *localize.Fare {
+	if c.Price > 0 {
+		return &localize.Fare{Full: c.Price, Half: halfFare(c.Price)}
+	}
+	if tariffs == nil {
+		return nil
+	}
+	stops := []string{}
+	for _, l := range c.Legs {
+		// Walks don't need a ticket, and may be to a stop outside the
+		// network.
+		if l.Mode == modes.Walk {
+			continue
+		}
+		for _, s := range AllStops(l) {
+			stops = append(stops, s.Name)
+		}
+	}
+	q, ok := tariffs.Quote(stops)
+	if !ok {
+		return nil
+	}
+	return &localize.Fare{Full: q.Full, Half: q.Half, Network: q.Network, Zones: q.Zones}
+}
+
+// halfFare is full with a half-fare card: half, rounded up to 10 centimes.
+func halfFare(full float64) float64 {
+	return math.Ceil(full*10/2) / 10
+}
@@ -0,0 +1,73 @@
+package query
+
+import (
+	"math"
+	"time"
+
+	"localize"
+	"transport"
+)
+
+// Locate estimates where the vehicle running d is at t on its way to
+// station, from d's stop times and delays. It returns false if station
+// isn't one of d's stops or the vehicle has already left it.
+func Locate(d localize.Departure, station string, t time.Time) (localize.Position, bool) {
+	stops := AllStops(d)
+	at := indexOf(stops, station)
+	if at < 0 {
+		return localize.Position{}, false
+	}
+	last, next := progress(stops, t)
+	if next < 0 || next > at {
+		return localize.Position{}, false
+	}
+	pos := localize.Position{Next: &stops[next], StopsAway: at - next}
+	if last >= 0 {
+		pos.Last = &stops[last]
+		pos.StopsAway = at - last
+	}
+	arrival := stops[at].ExpectedArrival()
+	if arrival.IsZero() {
+		arrival = stops[at].ExpectedDeparture()
+	}
+	if m := math.Ceil(arrival.Sub(t).Minutes()); m > 0 {
+		pos.Minutes = int(m)
+	}
+	return pos, true
+}
+
+// Approaching finds the next vehicle matching p's modes and routes on its
+// way to p.Source, from p.Source's arrivals at and after now, and where it
+// is. It returns nil if there's none we can locate. The departure is the
+// vehicle's run up to p.Source, so From is where it's coming from.
+func Approaching(svc transport.Transport, p Params, tz *time.Location, now time.Time) (*localize.Departure, localize.Position, error) {
+	p.Via = ""
+	p.Datetime = now
+	arrivals, err := board(svc, p, tz, transport.ARRIVAL)
+	if err != nil {
+		return nil, localize.Position{}, err
+	}
+	f := newFilter(p)
+	for _, a := range arrivals {
+		if !f.match(a) || a.Cancelled || len(a.Stops) == 0 {
+			continue
+		}
+		run := localize.Departure{
+			Name:      a.Name,
+			Mode:      a.Mode,
+			From:      a.Stops[0].Name,
+			To:        a.From,
+			Departing: a.Stops[0].Departing,
+			// The first stop has no arrival, so its delay is departing.
+			MinutesDelay: a.Stops[0].MinutesDelay,
+			Platform:     a.Stops[0].Platform,
+			Disruptions:  a.Disruptions,
+		}
+		run.Stops = append(run.Stops, a.Stops[1:]...)
+		run.Stops = append(run.Stops, localize.Stop{Name: a.From, Arriving: a.Departing, MinutesDelay: a.MinutesDelay, Platform: a.Platform})
+		if pos, ok := Locate(run, a.From, now); ok {
+			return &run, pos, nil
+		}
+	}
+	return nil, localize.Position{}, nil
+}
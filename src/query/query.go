@@ -0,0 +1,739 @@
+// Package query turns transport API responses into the departure and station
+// lists we speak (or serve) to users. It holds the filtering logic shared by
+// the Dialogflow webhook and the JSON API.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lines"
+	"localize"
+	"modes"
+	"transport"
+)
+
+// Params describes a departures or connections query.
+type Params struct {
+	// Source is the station name to depart from. If empty, the nearest
+	// station to Lat/Lon is used.
+	Source      string
+	Destination string
+	Lat         float64
+	Lon         float64
+	Datetime    time.Time
+	// ArriveBy makes Datetime the arrival time for connections.
+	ArriveBy bool
+	// Transport and Route restrict results to the given modes and lines.
+	// Modes are named as modes.Parse understands, so "any" is no
+	// restriction.
+	Transport []string
+	Route     []string
+	// Via restricts results to those stopping there on the way.
+	Via string
+	// StepFree restricts results to those the provider says are
+	// wheelchair accessible. For connections, every leg must be.
+	StepFree bool
+	// LeastCrowded orders connections by how busy they're expected to be
+	// in 2nd class, least first, instead of by time. Only then are their
+	// occupancy forecasts fetched.
+	LeastCrowded bool
+	// Limit is the number of results to return; 0 means no limit.
+	Limit int
+	// IgnoredIconClasses are prefixes of location icon classes which are
+	// not stations, e.g. street addresses, when looking up stations.
+	IgnoredIconClasses []string
+	// Until, if set, makes the query a window from Datetime to Until; see
+	// Window.
+	Until time.Time
+}
+
+// Connection is a single A-to-B connection, minus the walking legs.
+type Connection struct {
+	From      string
+	To        string
+	Departing time.Time
+	Arriving  time.Time
+	Legs      []localize.Departure
+	// URL is the search.ch page for the connections query.
+	URL string
+	// Supplement is whether a leg needs a supplement, e.g. on the night
+	// network.
+	Supplement bool
+	// Price is the full 2nd class fare in CHF, if the provider gives one.
+	Price float64
+}
+
+// Departure returns the first leg of the connection.
+func (c Connection) Departure() localize.Departure {
+	return c.Legs[0]
+}
+
+// Occupancy returns how busy c's busiest leg is expected to be in 2nd
+// class, or in 1st class if first is set.
+func (c Connection) Occupancy(first bool) localize.Occupancy {
+	o := localize.OccupancyUnknown
+	for _, l := range c.Legs {
+		lo := l.Occupancy2nd
+		if first {
+			lo = l.Occupancy1st
+		}
+		if lo > o {
+			o = lo
+		}
+	}
+	return o
+}
+
+// StepFree returns whether every leg of c is step-free.
+func (c Connection) StepFree() bool {
+	for _, l := range c.Legs {
+		if !l.StepFree {
+			return false
+		}
+	}
+	return true
+}
+
+// occupancy converts a leg's capacity, or its connection's if the leg
+// doesn't have one.
+func occupancy(leg, conn int) localize.Occupancy {
+	o := leg
+	if o == 0 {
+		o = conn
+	}
+	if o < 0 || o > int(localize.OccupancyHigh) {
+		return localize.OccupancyUnknown
+	}
+	return localize.Occupancy(o)
+}
+
+// capacities are an occupancy forecast for 1st and 2nd class.
+type capacities struct {
+	first, second int
+}
+
+// forecastKey finds a leg in both providers' responses: by when it leaves
+// and its line, since two may leave in the same minute. A connection is
+// found by when it leaves and its first leg's line.
+type forecastKey struct {
+	departing int64
+	line      string
+}
+
+func newForecastKey(departing int64, line string) forecastKey {
+	return forecastKey{departing, lines.Parse(line).String()}
+}
+
+// forecasts fetches the occupancy forecasts for creq's connections and for
+// their legs. They're only extra, so there are none if they can't be
+// fetched.
+func forecasts(svc transport.Transport, creq transport.ConnectionsRequest) (conns, legs map[forecastKey]capacities) {
+	conns, legs = map[forecastKey]capacities{}, map[forecastKey]capacities{}
+	oresp, err := svc.Occupancy(creq)
+	if err != nil {
+		return conns, legs
+	}
+	for _, c := range oresp.Connections {
+		first := ""
+		for _, s := range c.Sections {
+			if s.Journey == nil {
+				continue
+			}
+			line := journeyLine(s.Journey.Category, s.Journey.Number)
+			if first == "" {
+				first = line
+			}
+			legs[newForecastKey(s.Departure.DepartureTimestamp, line)] = capacities{s.Journey.Capacity1st, s.Journey.Capacity2nd}
+		}
+		conns[newForecastKey(c.From.DepartureTimestamp, first)] = capacities{c.Capacity1st, c.Capacity2nd}
+	}
+	return conns, legs
+}
+
+// stepFreeCodes are the service attribute codes, and stepFreeWords the
+// words in their texts, meaning a vehicle can be boarded without steps.
+var (
+	stepFreeCodes = map[string]bool{"NF": true}
+	stepFreeWords = []string{
+		"niederflur", "stufenlos", "rollstuhlgängig", "ebenerdig",
+		"low-floor", "low floor", "step-free", "wheelchair accessible",
+		"plancher surbaissé", "plain-pied", "accessible en fauteuil",
+	}
+)
+
+// stepFree returns whether attrs say a vehicle is step-free.
+func stepFree(attrs map[string]string) bool {
+	for code, text := range attrs {
+		if stepFreeCodes[strings.ToUpper(code)] {
+			return true
+		}
+		text = strings.ToLower(text)
+		for _, w := range stepFreeWords {
+			if strings.Contains(text, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cancelled is the delay of a cancelled departure.
+const cancelled = "X"
+
+// changedTrack marks a track which isn't the scheduled one, e.g. "7!".
+const changedTrack = "!"
+
+// parsePlatform returns the platform of a track, and whether it's changed.
+func parsePlatform(track string) (string, bool) {
+	track = strings.TrimSpace(track)
+	return strings.TrimSuffix(track, changedTrack), strings.HasSuffix(track, changedTrack)
+}
+
+func parseDelay(raw string) (int, error) {
+	if raw == "" || raw == cancelled {
+		return 0, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+// FilterStations drops locations whose icon class starts with one of
+// ignored, like street addresses, from a locations response, returning at
+// most limit stations, or all of them if limit is 0.
+func FilterStations(lresp transport.LocationsResponse, limit int, ignored []string) []localize.Station {
+	stats := []localize.Station{}
+	for _, s := range lresp {
+		if ignoredIconClass(s.Iconclass, ignored) {
+			continue
+		}
+		stats = append(stats, localize.Station{Name: s.Label, Distance: s.Dist})
+		if len(stats) == limit {
+			break
+		}
+	}
+	return stats
+}
+
+func ignoredIconClass(c string, ignored []string) bool {
+	for _, p := range ignored {
+		if strings.HasPrefix(c, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stations returns the limit stations closest to p.Lat/p.Lon, or all the
+// API gives if limit is 0, leaving out p.IgnoredIconClasses.
+func Stations(svc transport.Transport, p Params, limit int) ([]localize.Station, error) {
+	lresp, err := svc.Locations(transport.LocationsRequest{Lat: p.Lat, Lon: p.Lon})
+	if err != nil {
+		return nil, fmt.Errorf("Error calling Opendata: %v", err)
+	}
+	return FilterStations(lresp, limit, p.IgnoredIconClasses), nil
+}
+
+// Source returns the station to depart from: p.Source if given, otherwise the
+// nearest station to p.Lat/p.Lon. It returns "" if there is none.
+func Source(svc transport.Transport, p Params) (string, error) {
+	if p.Source != "" {
+		return p.Source, nil
+	}
+	// The Transport API does not take coordinates for starting locations,
+	// so look up the nearest station. This is inefficient unfortunately.
+	stats, err := Stations(svc, p, 1)
+	if err != nil || len(stats) == 0 {
+		return "", err
+	}
+	return stats[0].Name, nil
+}
+
+// Connections fetches connections from p.Source to p.Destination, filtered
+// by the first non-walking leg.
+func Connections(svc transport.Transport, p Params, tz *time.Location) ([]Connection, error) {
+	conns, err := connections(svc, p, tz)
+	if err != nil {
+		return nil, err
+	}
+	f := newFilter(p)
+	filtered := []Connection{}
+	for _, c := range conns {
+		if !f.match(c.Departure()) || (f.stepFree && !c.StepFree()) {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	if p.LeastCrowded {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return crowding(filtered[i]) < crowding(filtered[j])
+		})
+	}
+	if f.limit > 0 && len(filtered) > f.limit {
+		filtered = filtered[:f.limit]
+	}
+	return filtered, nil
+}
+
+// crowding ranks c for Params.LeastCrowded. We don't know how busy
+// connections without a forecast are, so they're in the middle.
+func crowding(c Connection) localize.Occupancy {
+	if o := c.Occupancy(false); o != localize.OccupancyUnknown {
+		return o
+	}
+	return localize.OccupancyMedium
+}
+
+// connections fetches the unfiltered connections for p.
+func connections(svc transport.Transport, p Params, tz *time.Location) ([]Connection, error) {
+	creq := transport.ConnectionsRequest{
+		Station:     p.Source,
+		Destination: p.Destination,
+		Via:         p.Via,
+		Datetime:    p.Datetime,
+		ArriveBy:    p.ArriveBy,
+	}
+	cresp, err := svc.Connections(creq)
+	if err != nil {
+		return nil, fmt.Errorf("Error calling Opendata: %v", err)
+	}
+	// Forecasts are another request, only worth it to order by them.
+	var connForecasts, legForecasts map[forecastKey]capacities
+	if p.LeastCrowded {
+		connForecasts, legForecasts = forecasts(svc, creq)
+	}
+	conns := []Connection{}
+	for _, c := range cresp.Connections {
+		conn := Connection{From: c.From, To: c.To, URL: cresp.URL, Price: c.Price}
+		if conn.Departing, err = time.ParseInLocation("2006-01-02 15:04:05", c.Departure, tz); err != nil {
+			return nil, err
+		}
+		if conn.Arriving, err = time.ParseInLocation("2006-01-02 15:04:05", c.Arrival, tz); err != nil {
+			return nil, err
+		}
+		for _, l := range c.Legs {
+			// XXX: Probably should warn people if they have to walk somewhere first.
+			// XXX: Not sure what "" type is, but it seems like the last entry sometimes?
+			if l.Type == "walk" || l.Type == "" {
+				continue
+			}
+			d := localize.Departure{
+				From: l.SbbName,
+				Name: l.Line,
+				To:   l.Exit.SbbName,
+				Mode: modes.FromCategory(l.Type),
+			}
+			d.Platform, d.PlatformChanged = parsePlatform(l.Track)
+			d.Disruptions = disruptions(l.Disruptions, l.Line, tz)
+			for _, s := range l.Stops {
+				stop := localize.Stop{Name: s.Name}
+				stop.Arriving, _ = time.ParseInLocation("2006-01-02 15:04:05", s.Arrival, tz)
+				stop.Departing, _ = time.ParseInLocation("2006-01-02 15:04:05", s.Departure, tz)
+				stop.MinutesDelay, _ = parseDelay(s.DepDelay)
+				d.Stops = append(d.Stops, stop)
+			}
+			if l.Exit.Name != "" {
+				exit := localize.Stop{Name: l.Exit.SbbName}
+				if exit.Name == "" {
+					exit.Name = l.Exit.Name
+				}
+				exit.Arriving, _ = time.ParseInLocation("2006-01-02 15:04:05", l.Exit.Arrival, tz)
+				exit.MinutesDelay, _ = parseDelay(l.Exit.ArrDelay)
+				exit.Platform, _ = parsePlatform(l.Exit.Track)
+				d.Stops = append(d.Stops, exit)
+			}
+			if len(conn.Legs) == 0 {
+				// Disruptions of the whole connection are told with its
+				// first leg.
+				d.Disruptions = append(disruptions(c.Disruptions, "", tz), d.Disruptions...)
+			}
+			if d.MinutesDelay, err = parseDelay(l.DepDelay); err != nil {
+				return nil, err
+			}
+			d.Cancelled = l.DepDelay == cancelled
+			if d.Departing, err = time.ParseInLocation("2006-01-02 15:04:05", l.Departure, tz); err != nil {
+				return nil, err
+			}
+			d.TripID = l.Tripid
+			d.StepFree = stepFree(l.Attributes)
+			first := d.Name
+			if len(conn.Legs) > 0 {
+				first = conn.Legs[0].Name
+			}
+			lf := legForecasts[newForecastKey(d.Departing.Unix(), d.Name)]
+			cf := connForecasts[newForecastKey(conn.Departing.Unix(), first)]
+			d.Occupancy1st, d.Occupancy2nd = occupancy(lf.first, cf.first), occupancy(lf.second, cf.second)
+			conn.Legs = append(conn.Legs, d)
+			for _, a := range l.Attributes {
+				a = strings.ToLower(a)
+				if strings.Contains(a, "zuschlag") || strings.Contains(a, "supplément") || strings.Contains(a, "supplement") {
+					conn.Supplement = true
+				}
+			}
+		}
+		if len(conn.Legs) == 0 {
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// Stationboard fetches the departures from p.Source, filtered by p.
+func Stationboard(svc transport.Transport, p Params, tz *time.Location) ([]localize.Departure, error) {
+	departures, err := stationboard(svc, p, tz)
+	if err != nil {
+		return nil, err
+	}
+	return Filter(departures, p), nil
+}
+
+// stationboard fetches the unfiltered departures from p.Source.
+func stationboard(svc transport.Transport, p Params, tz *time.Location) ([]localize.Departure, error) {
+	return board(svc, p, tz, transport.DEPARTURE)
+}
+
+// board fetches p.Source's departures or, if mode is transport.ARRIVAL,
+// its arrivals. Arrivals are "departing" when they arrive, and their Stops
+// are those before p.Source.
+func board(svc transport.Transport, p Params, tz *time.Location, mode int) ([]localize.Departure, error) {
+	sreq := transport.StationboardRequest{
+		Station:  p.Source,
+		Mode:     mode,
+		Datetime: p.Datetime,
+	}
+	sresp, err := svc.Stationboard(sreq)
+	if err != nil {
+		return nil, fmt.Errorf("Error calling Opendata: %v", err)
+	}
+	departures := []localize.Departure{}
+	for _, c := range sresp.Connections {
+		d := localize.Departure{
+			From: sresp.Stop.Name,
+			Name: c.Line,
+			To:   c.Terminal.Name,
+			Mode: modes.FromCategory(c.Type),
+		}
+		d.Platform, d.PlatformChanged = parsePlatform(c.Track)
+		d.Disruptions = disruptions(c.Disruptions, c.Line, tz)
+		for _, s := range c.SubsequentStops {
+			stop := localize.Stop{Name: s.Name}
+			// Unparseable times are zero: the terminal has no departure.
+			stop.Arriving, _ = time.ParseInLocation("2006-01-02 15:04:05", s.Arr, tz)
+			stop.Departing, _ = time.ParseInLocation("2006-01-02 15:04:05", s.Dep, tz)
+			delay := s.ArrDelay
+			if stop.Arriving.IsZero() {
+				delay = s.DepDelay
+			}
+			stop.MinutesDelay, _ = parseDelay(delay)
+			d.Stops = append(d.Stops, stop)
+		}
+		delay := c.DepDelay
+		if mode == transport.ARRIVAL {
+			delay = c.ArrDelay
+		}
+		if d.MinutesDelay, err = parseDelay(delay); err != nil {
+			return nil, err
+		}
+		d.Cancelled = delay == cancelled
+		d.StepFree = stepFree(c.Attributes)
+		if d.Departing, err = time.ParseInLocation("2006-01-02 15:04:05", c.Time, tz); err != nil {
+			return nil, err
+		}
+		departures = append(departures, d)
+	}
+	return departures, nil
+}
+
+// Departures returns the next departures matching p, from either /connections
+// (if p.Destination is set) or /stationboard. For connections, only the first
+// leg of each is returned. This lets us share the localization code.
+func Departures(svc transport.Transport, p Params, tz *time.Location) ([]localize.Departure, error) {
+	return page(svc, p, tz, true)
+}
+
+// page fetches one page of what Departures returns, filtered by p only if
+// filtered is set.
+func page(svc transport.Transport, p Params, tz *time.Location, filtered bool) ([]localize.Departure, error) {
+	if p.Destination == "" {
+		deps, err := stationboard(svc, p, tz)
+		if err != nil || !filtered {
+			return deps, err
+		}
+		return Filter(deps, p), nil
+	}
+	fetch := connections
+	if filtered {
+		fetch = Connections
+	}
+	conns, err := fetch(svc, p, tz)
+	if err != nil {
+		return nil, err
+	}
+	deps := []localize.Departure{}
+	for _, c := range conns {
+		// XXX: Probably should say SOMETHING about the following legs.
+		deps = append(deps, c.Departure())
+	}
+	return deps, nil
+}
+
+// MaxWindow is the longest period treated as a window, e.g. "this
+// afternoon"; longer ones, like a whole day, just give a start time.
+const MaxWindow = 8 * time.Hour
+
+// Window pages through the departures matching p from p.Datetime (or now)
+// to p.Until, ignoring p.Limit. It makes at most maxPages requests, so a
+// long window at a busy station may be cut short.
+func Window(svc transport.Transport, p Params, tz *time.Location, now time.Time) ([]localize.Departure, error) {
+	if p.Datetime.IsZero() {
+		p.Datetime = now
+	}
+	start, until := p.Datetime, p.Until
+	f := newFilter(p)
+	deps := []localize.Departure{}
+	seen := map[string]bool{}
+	for i := 0; i < maxPages; i++ {
+		batch, err := page(svc, p, tz, false)
+		if err != nil {
+			return nil, err
+		}
+		next := p.Datetime
+		for _, d := range batch {
+			if d.Departing.After(next) {
+				next = d.Departing
+			}
+			key := d.Departing.String() + " " + d.Name + " " + d.To
+			if seen[key] || d.Departing.Before(start) || d.Departing.After(until) || !f.match(d) {
+				continue
+			}
+			seen[key] = true
+			deps = append(deps, d)
+		}
+		if !next.After(p.Datetime) || next.After(until) {
+			break
+		}
+		p.Datetime = next.Add(1 * time.Minute)
+	}
+	sort.SliceStable(deps, func(i, j int) bool { return deps[i].Departing.Before(deps[j].Departing) })
+	return deps, nil
+}
+
+type filter struct {
+	modes    modes.Set
+	routes   []string
+	via      string
+	stepFree bool
+	limit    int
+}
+
+func newFilter(p Params) filter {
+	f := filter{modes: modes.NewSet(p.Transport), routes: p.Route, stepFree: p.StepFree, limit: p.Limit}
+	if p.Destination == "" {
+		// Connections are routed via it by the API instead, and it needn't
+		// be on the first leg.
+		f.via = p.Via
+	}
+	return f
+}
+
+func (f filter) match(d localize.Departure) bool {
+	// If the user specified specific routes, skip on that basis.
+	if len(f.routes) > 0 {
+		ok := false
+		for _, r := range f.routes {
+			if lines.Match(r, d.Name, d.Mode) {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	// Or if the user specified modes.
+	if !f.modes.Match(d.Mode) {
+		return false
+	}
+	if f.via != "" {
+		if _, ok := StopAt(d, f.via); !ok {
+			return false
+		}
+	}
+	if f.stepFree && !d.StepFree {
+		return false
+	}
+	return true
+}
+
+// Filter returns the departures matching p's modes and routes, up to p's
+// limit.
+func Filter(departures []localize.Departure, p Params) []localize.Departure {
+	f := newFilter(p)
+	filtered := []localize.Departure{}
+	for _, d := range departures {
+		if !f.match(d) {
+			continue
+		}
+		filtered = append(filtered, d)
+		if len(filtered) == f.limit {
+			break
+		}
+	}
+	return filtered
+}
+
+// WalkingTime returns how long it takes to walk meters at kmh km/h.
+func WalkingTime(meters, kmh float64) time.Duration {
+	return time.Duration(meters / (kmh * 1000) * float64(time.Hour))
+}
+
+// A Plan says when to leave to catch a departure.
+type Plan struct {
+	// Station is where to walk to, and how far it is.
+	Station localize.Station
+	Walk    time.Duration
+	// Departure is the first one which can be caught.
+	Departure localize.Departure
+	// Leave is when to leave to catch it.
+	Leave time.Time
+}
+
+// PlanLeave finds the first departure matching p which can be caught when
+// walking from p.Lat/p.Lon at kmh km/h, with buffer to spare. It leaves from
+// the nearest station, or from p.Source if that's nearby. It returns false
+// if there's no departure to catch.
+func PlanLeave(svc transport.Transport, p Params, kmh float64, buffer time.Duration, now time.Time, tz *time.Location) (Plan, bool, error) {
+	stats, err := Stations(svc, p, 10)
+	if err != nil || len(stats) == 0 {
+		return Plan{}, false, err
+	}
+	plan := Plan{Station: stats[0]}
+	for _, s := range stats {
+		if p.Source != "" && strings.EqualFold(s.Name, p.Source) {
+			plan.Station = s
+		}
+	}
+	plan.Walk = WalkingTime(plan.Station.Distance, kmh) + buffer
+	earliest := now.Add(plan.Walk)
+
+	p.Source = plan.Station.Name
+	if p.Datetime.Before(earliest) {
+		p.Datetime = earliest
+	}
+	// Departures before earliest may be late enough to catch, and some
+	// may be missed despite leaving after it, so look a bit earlier, and
+	// don't stop at the limit.
+	p.Datetime = p.Datetime.Add(-15 * time.Minute)
+	p.Limit = 20
+	deps, err := Departures(svc, p, tz)
+	if err != nil {
+		return Plan{}, false, err
+	}
+	for _, d := range deps {
+		actual := d.Departing.Add(time.Duration(d.MinutesDelay) * time.Minute)
+		if d.Cancelled || actual.Before(earliest) {
+			continue
+		}
+		plan.Departure = d
+		plan.Leave = actual.Add(-plan.Walk)
+		return plan, true, nil
+	}
+	return Plan{}, false, nil
+}
+
+// ServiceDayStart is when the timetable's day starts. Departures before then
+// belong to the day before, e.g. 01:30 is still "tonight".
+const ServiceDayStart = 4 * time.Hour
+
+// ServiceDayEnd returns when the service day t is in ends.
+func ServiceDayEnd(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(ServiceDayStart)
+	if !t.Before(end) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(ServiceDayStart)
+	}
+	return end
+}
+
+var nightLine = regexp.MustCompile(`^(SN|N)\s*\d+$`)
+
+// IsNight returns whether a line is on the night network, e.g. SN1 or N14.
+func IsNight(line string) bool {
+	return nightLine.MatchString(line)
+}
+
+func (c Connection) isNight() bool {
+	for _, l := range c.Legs {
+		if IsNight(l.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tonight is the rest of a service day's connections.
+type Tonight struct {
+	// Last is the last regular connection, or nil if it's left.
+	Last *Connection
+	// Night are the night network connections after Last.
+	Night []Connection
+	// First is the first connection of the next service day, if found.
+	First *Connection
+}
+
+// maxPages bounds how many pages of results, each a request, Window and
+// LastConnection fetch.
+const maxPages = 12
+
+// LastConnection pages through the connections matching p, from p.Datetime
+// (or now) to the end of its service day.
+func LastConnection(svc transport.Transport, p Params, tz *time.Location, now time.Time) (Tonight, error) {
+	if p.Datetime.IsZero() {
+		p.Datetime = now
+	}
+	end := ServiceDayEnd(p.Datetime.In(tz))
+	tonight := Tonight{}
+	seen := map[string]bool{}
+	p.Limit = 100
+	for page := 0; page < maxPages; page++ {
+		conns, err := Connections(svc, p, tz)
+		if err != nil {
+			return tonight, err
+		}
+		next := p.Datetime
+		for i := range conns {
+			c := conns[i]
+			key := c.Departing.String() + " " + c.Departure().Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if c.Departing.After(next) {
+				next = c.Departing
+			}
+			if c.Departure().Cancelled {
+				continue
+			}
+			if !c.Departing.Before(end) {
+				tonight.First = &c
+				return tonight, nil
+			}
+			if c.isNight() {
+				tonight.Night = append(tonight.Night, c)
+			} else {
+				tonight.Last = &c
+				// Night connections only count after the last
+				// regular one.
+				tonight.Night = nil
+			}
+		}
+		if !next.After(p.Datetime) {
+			// No progress; there's nothing more.
+			break
+		}
+		p.Datetime = next.Add(1 * time.Minute)
+	}
+	return tonight, nil
+}
@@ -0,0 +1,637 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fares"
+	"localize"
+	"modes"
+	"transport"
+)
+
+// fakeAPI serves canned completion and stationboard responses.
+func fakeAPI(t *testing.T, locations, stationboard string) (transport.Transport, func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/completion.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(locations))
+	})
+	mux.HandleFunc("/stationboard.json", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("stop"); got != "Stadelhofen" {
+			t.Errorf("want stop 'Stadelhofen', got '%v'", got)
+		}
+		w.Write([]byte(stationboard))
+	})
+	srv := httptest.NewServer(mux)
+	return transport.Transport{
+		Client: srv.Client(),
+		Endpoints: transport.Endpoints{
+			Stationboard: srv.URL + "/stationboard.json",
+			Locations:    srv.URL + "/completion.json",
+		},
+	}, srv.Close
+}
+
+func TestWalkingTime(t *testing.T) {
+	if got, want := WalkingTime(450, 4.5), 6*time.Minute; got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// ignored are the icon classes of locations which aren't stations.
+var ignored = []string{"sl-icon-type-adr", "sl-icon-tel"}
+
+func TestPlanLeave(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, done := fakeAPI(t,
+		`[{"label": "Zürich, Kreuzstrasse", "dist": 80, "iconclass": "sl-icon-type-adr"},
+		  {"label": "Stadelhofen", "dist": 450, "iconclass": "sl-icon-type-train"},
+		  {"label": "Bellevue", "dist": 600, "iconclass": "sl-icon-type-tram"}]`,
+		`{"stop": {"name": "Stadelhofen"}, "connections": [
+		  {"time": "2018-03-05 12:03:00", "type": "strain", "line": "S6", "terminal": {"name": "Baden"}},
+		  {"time": "2018-03-05 12:05:00", "type": "strain", "line": "S16", "terminal": {"name": "Flughafen"}, "dep_delay": "+3"},
+		  {"time": "2018-03-05 12:09:00", "type": "strain", "line": "S18", "terminal": {"name": "Esslingen"}, "dep_delay": "X"},
+		  {"time": "2018-03-05 12:10:00", "type": "strain", "line": "S7", "terminal": {"name": "Rapperswil"}}]}`)
+	defer done()
+
+	now := time.Date(2018, time.March, 5, 12, 0, 0, 0, tz)
+	plan, ok, err := PlanLeave(svc, Params{Lat: 47.36, Lon: 8.55, IgnoredIconClasses: ignored}, 4.5, 1*time.Minute, now, tz)
+	if err != nil || !ok {
+		t.Fatalf("want a plan, got %v, %v", ok, err)
+	}
+	// A 6 minute walk and a minute to spare means leaving at 12:00 for
+	// 12:07 at the earliest. The S6 is gone by then, but the S16 is late.
+	if plan.Station.Name != "Stadelhofen" || plan.Walk != 7*time.Minute {
+		t.Errorf("want 7 minutes to Stadelhofen, got %v to %v", plan.Walk, plan.Station.Name)
+	}
+	if plan.Departure.Name != "S16" {
+		t.Errorf("want S16, got %v", plan.Departure.Name)
+	}
+	if want := time.Date(2018, time.March, 5, 12, 1, 0, 0, tz); !plan.Leave.Equal(want) {
+		t.Errorf("want to leave at %v, got %v", want, plan.Leave)
+	}
+
+	// Dawdling, we miss the S16, and the S18 is cancelled.
+	plan, ok, err = PlanLeave(svc, Params{Lat: 47.36, Lon: 8.55, IgnoredIconClasses: ignored}, 4.5, 1*time.Minute, now.Add(2*time.Minute), tz)
+	if err != nil || !ok || plan.Departure.Name != "S7" {
+		t.Errorf("want S7, got %v, %v, %v", plan.Departure.Name, ok, err)
+	}
+}
+
+// fakeRoute serves two connections at a time from a day's timetable, like
+// search.ch's route.json.
+func fakeRoute(t *testing.T, tz *time.Location, timetable []string) (transport.Transport, *int, func()) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		from, err := time.ParseInLocation("2006-01-02 15:04", r.URL.Query().Get("date")+" "+r.URL.Query().Get("time"), tz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns := []interface{}{}
+		for _, c := range timetable {
+			var dep, line, attr string
+			fmt.Sscan(c, &dep, &line, &attr)
+			d, _ := time.ParseInLocation("2006-01-02T15:04", dep, tz)
+			if d.Before(from) || len(conns) == 2 {
+				continue
+			}
+			leg := map[string]interface{}{
+				"departure": d.Format("2006-01-02 15:04:05"), "type": "strain", "line": line,
+				"exit": map[string]string{"arrival": d.Add(20 * time.Minute).Format("2006-01-02 15:04:05")},
+			}
+			if attr == "cancelled" {
+				leg["dep_delay"] = "X"
+			} else if attr != "" {
+				leg["attributes"] = map[string]string{"NZ": attr}
+			}
+			conns = append(conns, map[string]interface{}{
+				"from":      "Zürich HB",
+				"to":        "Uster",
+				"departure": d.Format("2006-01-02 15:04:05"),
+				"arrival":   d.Add(20 * time.Minute).Format("2006-01-02 15:04:05"),
+				"legs":      []interface{}{leg},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"connections": conns})
+	}))
+	return transport.Transport{
+		Client:    srv.Client(),
+		Endpoints: transport.Endpoints{Connections: srv.URL},
+	}, &requests, srv.Close
+}
+
+func TestLastConnection(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, requests, done := fakeRoute(t, tz, []string{
+		"2018-03-05T23:10 S9",
+		"2018-03-05T23:40 S9",
+		"2018-03-06T00:20 S9",
+		"2018-03-06T01:10 SN9 Nachtzuschlag",
+		"2018-03-06T02:10 SN9",
+		"2018-03-06T05:10 S9",
+	})
+	defer done()
+	p := Params{Source: "Zürich HB", Destination: "Uster"}
+
+	now := time.Date(2018, time.March, 5, 23, 0, 0, 0, tz)
+	tonight, err := LastConnection(svc, p, tz, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tonight.Last == nil || tonight.Last.Departing.Format("15:04") != "00:20" {
+		t.Fatalf("want the 00:20 last, got %+v", tonight.Last)
+	}
+	if len(tonight.Night) != 2 || !tonight.Night[0].Supplement || tonight.Night[1].Supplement {
+		t.Errorf("want two night connections, the first with a supplement, got %+v", tonight.Night)
+	}
+	if tonight.First == nil || tonight.First.Departing.Format("15:04") != "05:10" {
+		t.Errorf("want the 05:10 first, got %+v", tonight.First)
+	}
+	if *requests > 4 {
+		t.Errorf("want at most 4 requests, got %v", *requests)
+	}
+
+	// After midnight it's still the same night, and the last has left.
+	now = time.Date(2018, time.March, 6, 0, 30, 0, 0, tz)
+	if tonight, err = LastConnection(svc, p, tz, now); err != nil {
+		t.Fatal(err)
+	}
+	if tonight.Last != nil || len(tonight.Night) != 2 {
+		t.Errorf("want no last and two night connections, got %+v and %+v", tonight.Last, tonight.Night)
+	}
+
+	// A cancelled connection is never the last.
+	svc, _, done = fakeRoute(t, tz, []string{
+		"2018-03-05T23:40 S9",
+		"2018-03-06T00:35 S9 cancelled",
+		"2018-03-06T05:10 S9",
+	})
+	defer done()
+	if tonight, err = LastConnection(svc, p, tz, time.Date(2018, time.March, 5, 23, 0, 0, 0, tz)); err != nil {
+		t.Fatal(err)
+	}
+	if tonight.Last == nil || tonight.Last.Departing.Format("15:04") != "23:40" {
+		t.Errorf("want the 23:40 last, got %+v", tonight.Last)
+	}
+}
+
+func TestServiceDayEnd(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	for _, tc := range []struct{ t, want time.Time }{
+		{time.Date(2018, time.March, 5, 12, 0, 0, 0, tz), time.Date(2018, time.March, 6, 4, 0, 0, 0, tz)},
+		{time.Date(2018, time.March, 6, 1, 0, 0, 0, tz), time.Date(2018, time.March, 6, 4, 0, 0, 0, tz)},
+		{time.Date(2018, time.March, 6, 4, 0, 0, 0, tz), time.Date(2018, time.March, 7, 4, 0, 0, 0, tz)},
+	} {
+		if got := ServiceDayEnd(tc.t); !got.Equal(tc.want) {
+			t.Errorf("%v: want %v, got %v", tc.t, tc.want, got)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, requests, done := fakeRoute(t, tz, []string{
+		"2018-03-05T16:50 S9",
+		"2018-03-05T17:00 S9",
+		"2018-03-05T17:10 S5",
+		"2018-03-05T17:20 S9",
+		"2018-03-05T17:30 S5",
+		"2018-03-05T17:40 S9",
+		"2018-03-05T18:00 S9",
+		"2018-03-05T18:10 S9",
+	})
+	defer done()
+	at := func(hour, min int) time.Time {
+		return time.Date(2018, time.March, 5, hour, min, 0, 0, tz)
+	}
+	p := Params{Source: "Zürich HB", Destination: "Uster", Route: []string{"S9"}, Datetime: at(17, 0), Until: at(18, 0), Limit: 2}
+
+	deps, err := Window(svc, p, tz, at(12, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, d := range deps {
+		got = append(got, d.Departing.Format("15:04"))
+	}
+	if want := "[17:00 17:20 17:40 18:00]"; fmt.Sprint(got) != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	// Two at a time, the last page being the one past 18:00.
+	if *requests != 4 {
+		t.Errorf("want 4 requests, got %v", *requests)
+	}
+}
+
+func TestResolveStation(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		locations  string
+		station    string
+		candidates []string
+	}{
+		{
+			"Bahnhof Oerlikon",
+			`[{"label": "Zürich, Bahnhof Oerlikon Nord", "iconclass": "sl-icon-type-bus"},
+			  {"label": "Zürich Oerlikon", "iconclass": "sl-icon-type-train"}]`,
+			"Zürich Oerlikon", nil,
+		},
+		{
+			"Bahnhofstrasse",
+			`[{"label": "Bahnhofstrasse 1, Uster", "iconclass": "sl-icon-type-adr"},
+			  {"label": "Uster, Bahnhofstrasse", "iconclass": "sl-icon-type-bus"},
+			  {"label": "Zug, Bahnhofstrasse", "iconclass": "sl-icon-type-bus"},
+			  {"label": "Zürich, Bahnhofstrasse/HB", "iconclass": "sl-icon-type-tram"},
+			  {"label": "Bahnhof Stettbach", "iconclass": "sl-icon-type-train"}]`,
+			"Uster, Bahnhofstrasse", []string{"Uster, Bahnhofstrasse", "Zug, Bahnhofstrasse", "Zürich, Bahnhofstrasse/HB"},
+		},
+		{
+			"Stadelhofen",
+			`[{"label": "Stadelhofen", "iconclass": "sl-icon-type-train"},
+			  {"label": "Zürich, Stadelhoferplatz", "iconclass": "sl-icon-type-tram"}]`,
+			"Stadelhofen", nil,
+		},
+		{
+			// Said exactly, though the API ranks it second.
+			"Zug, Bahnhofstrasse",
+			`[{"label": "Zug, Bahnhofstrasse Süd", "iconclass": "sl-icon-type-bus"},
+			  {"label": "Zug, Bahnhofstrasse", "iconclass": "sl-icon-type-bus"}]`,
+			"Zug, Bahnhofstrasse", nil,
+		},
+		{
+			"Atlantis",
+			`[{"label": "Atlantisstrasse 1, Zürich", "iconclass": "sl-icon-type-adr"}]`,
+			"Atlantis", nil,
+		},
+	} {
+		svc, done := fakeAPI(t, tc.locations, "")
+		r, err := ResolveStation(svc, tc.name, nil, ignored)
+		done()
+		if err != nil {
+			t.Errorf("%v: want nil, got '%v'", tc.name, err)
+			continue
+		}
+		if r.Station != tc.station || fmt.Sprint(r.Candidates) != fmt.Sprint(tc.candidates) {
+			t.Errorf("%v: want %v of %v, got %v of %v", tc.name, tc.station, tc.candidates, r.Station, r.Candidates)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for track, want := range map[string]string{"": " false", "3": "3 false", "7!": "7 true", "12AB!": "12AB true"} {
+		p, changed := parsePlatform(track)
+		if got := fmt.Sprint(p, " ", changed); got != want {
+			t.Errorf("%q: want %v, got %v", track, want, got)
+		}
+	}
+}
+
+func TestDisruptions(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, done := fakeAPI(t, "", `{"stop": {"name": "Stadelhofen"}, "connections": [
+	  {"time": "2018-03-05 12:03:00", "type": "strain", "line": "S8", "terminal": {"name": "Winterthur"},
+	   "disruptions": {"d1": {"id": "d1", "header": "Winterthur - Effretikon: construction work.", "timerange": "01.03.2018 - 10.03.2018", "priority": 50},
+	                   "d2": {"id": "d2", "header": "Last week's work", "timerange": "20.02.2018 05:00 - 27.02.2018 23:59"}}},
+	  {"time": "2018-03-05 12:05:00", "type": "strain", "line": "S16", "terminal": {"name": "Flughafen"}, "disruptions": []},
+	  {"time": "2018-03-05 12:18:00", "type": "strain", "line": "S8", "terminal": {"name": "Winterthur"},
+	   "disruptions": [{"id": "d1", "header": "Winterthur - Effretikon: construction work."}]}]}`)
+	defer done()
+	now := time.Date(2018, time.March, 5, 12, 0, 0, 0, tz)
+
+	ds, err := Disruptions(svc, Params{Source: "Stadelhofen", Route: []string{"S 8"}}, tz, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].ID != "d1" || fmt.Sprint(ds[0].Lines) != "[S8]" {
+		t.Fatalf("want the current S8 disruption, got %+v", ds)
+	}
+	if want := time.Date(2018, time.March, 10, 23, 59, 0, 0, tz); !ds[0].End.Equal(want) {
+		t.Errorf("want it to end at %v, got %v", want, ds[0].End)
+	}
+	if ds, _ = Disruptions(svc, Params{Source: "Stadelhofen", Route: []string{"S16"}}, tz, now); len(ds) != 0 {
+		t.Errorf("want no disruptions on the S16, got %+v", ds)
+	}
+}
+
+func TestStops(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, done := fakeAPI(t, "", `{"stop": {"name": "Stadelhofen"}, "connections": [
+	  {"time": "2018-03-05 12:04:00", "type": "strain", "line": "S5", "terminal": {"name": "Pfäffikon SZ"},
+	   "subsequent_stops": [{"name": "Stettbach", "dep": "2018-03-05 12:07:00"}, {"name": "Uster", "arr": "2018-03-05 12:19:00", "dep": "2018-03-05 12:20:00"}]},
+	  {"time": "2018-03-05 12:06:00", "type": "strain", "line": "S8", "terminal": {"name": "Winterthur"},
+	   "subsequent_stops": [{"name": "Wallisellen", "dep": "2018-03-05 12:15:00"}, {"name": "Winterthur Grüze", "arr": "2018-03-05 12:30:00"}]}]}`)
+	defer done()
+	at := time.Date(2018, time.March, 5, 12, 0, 0, 0, tz)
+
+	c, err := NextCall(svc, Params{Source: "Stadelhofen", Route: []string{"S5"}, Datetime: at}, "uster", tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Stop == nil || c.Stop.Name != "Uster" || c.Stop.Arriving.Minute() != 19 {
+		t.Fatalf("want the S5 to arrive in Uster at 12:19, got %+v", c)
+	}
+	if c, _ = NextCall(svc, Params{Source: "Stadelhofen", Route: []string{"S8"}, Datetime: at}, "Winterthur", tz); c == nil || c.Stop != nil {
+		t.Errorf("want the S8 not to stop in Winterthur, got %+v", c)
+	}
+
+	ds, err := Departures(svc, Params{Source: "Stadelhofen", Via: "Uster", Datetime: at}, tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].Name != "S5" {
+		t.Errorf("want only the S5 via Uster, got %+v", ds)
+	}
+}
+
+// journey is transport.opendata.ch's journey for the S5 from Zürich HB at
+// 12:01, two minutes late at Stadelhofen and three into Uster.
+const journey = `{"name": "S5 18536", "category": "S", "number": "5", "operator": "SBB", "to": "Pfäffikon SZ",
+  "passList": [
+    {"station": {"id": "8503000", "name": "Zürich HB"}, "arrival": null, "arrivalTimestamp": null,
+     "departure": "2018-03-05T12:01:00+0100", "departureTimestamp": 1520247660, "delay": 0, "platform": "41/42",
+     "prognosis": {"platform": null}},
+    {"station": {"id": "8503003", "name": "Zürich Stadelhofen"}, "arrival": "2018-03-05T12:03:00+0100", "arrivalTimestamp": 1520247780,
+     "departure": "2018-03-05T12:04:00+0100", "departureTimestamp": 1520247840, "delay": 2, "platform": "3",
+     "prognosis": {"platform": "4"}},
+    {"station": {"id": "8503147", "name": "Stettbach"}, "arrival": "2018-03-05T12:07:00+0100", "arrivalTimestamp": 1520248020,
+     "departure": "2018-03-05T12:08:00+0100", "departureTimestamp": 1520248080, "delay": null, "platform": "2"},
+    {"station": {"id": "8503125", "name": "Uster"}, "arrival": "2018-03-05T12:19:00+0100", "arrivalTimestamp": 1520248740,
+     "departure": "2018-03-05T12:20:00+0100", "departureTimestamp": 1520248800, "delay": 3, "platform": "1"},
+    {"station": {"id": "8503225", "name": "Pfäffikon SZ"}, "arrival": "2018-03-05T12:50:00+0100", "arrivalTimestamp": 1520250600,
+     "departure": null, "departureTimestamp": null, "delay": 0, "platform": "5"}],
+  "capacity1st": 1, "capacity2nd": 2}`
+
+func TestTrip(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/route.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"connections": [{"from": "Zürich Stadelhofen", "to": "Uster", "departure": "2018-03-05 12:04:00", "arrival": "2018-03-05 12:19:00",
+		  "legs": [{"departure": "2018-03-05 12:04:00", "tripid": "T2018-03-05-18536", "sbb_name": "Zürich Stadelhofen", "type": "strain", "line": "S5",
+		            "exit": {"sbb_name": "Uster", "arrival": "2018-03-05 12:19:00"}}]}]}`))
+	})
+	mux.HandleFunc("/journey", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "T2018-03-05-18536" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": [{"message": "Journey not found"}]}`))
+			return
+		}
+		w.Write([]byte(journey))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	svc := transport.Transport{
+		Client: srv.Client(),
+		Endpoints: transport.Endpoints{
+			Connections: srv.URL + "/route.json",
+			Trip:        srv.URL + "/journey",
+		},
+	}
+
+	conns, err := Connections(svc, Params{Source: "Stadelhofen", Destination: "Uster"}, tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := conns[0].Departure().TripID
+	if want := "T2018-03-05-18536"; id != want {
+		t.Fatalf("want the leg's trip ID %q, got %q", want, id)
+	}
+	d, err := Trip(svc, id, tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "S5" || d.Mode != modes.Train || d.From != "Zürich HB" || d.To != "Pfäffikon SZ" || d.TripID != id || len(d.Stops) != 4 {
+		t.Fatalf("want the S5 from Zürich HB with 4 more stops, got %+v", d)
+	}
+	if want := time.Date(2018, time.March, 5, 12, 1, 0, 0, tz); !d.Departing.Equal(want) || d.Platform != "41/42" {
+		t.Errorf("want it leaving at %v from 41/42, got %v from %v", want, d.Departing, d.Platform)
+	}
+	if st := d.Stops[0]; st.Name != "Zürich Stadelhofen" || st.MinutesDelay != 2 || st.Platform != "4" {
+		t.Errorf("want it 2 minutes late at Stadelhofen, on platform 4, got %+v", st)
+	}
+	if d.Occupancy2nd != localize.OccupancyMedium {
+		t.Errorf("want medium occupancy, got %v", d.Occupancy2nd)
+	}
+
+	at := func(hh, mm int) time.Time { return time.Date(2018, time.March, 5, hh, mm, 0, 0, tz) }
+	name := func(s *localize.Stop) string {
+		if s == nil {
+			return "-"
+		}
+		return s.Name
+	}
+	for _, tc := range []struct {
+		at         time.Time
+		last, next string
+	}{
+		{at(12, 0), "-", "Zürich HB"},
+		{at(12, 2), "Zürich HB", "Zürich Stadelhofen"},
+		{at(12, 5), "Zürich Stadelhofen", "Zürich Stadelhofen"},
+		{at(12, 10), "Stettbach", "Uster"},
+		// It's three minutes late into Uster.
+		{at(12, 22), "Uster", "Uster"},
+		{at(12, 30), "Uster", "Pfäffikon SZ"},
+		{at(13, 0), "Pfäffikon SZ", "-"},
+	} {
+		last, next := Progress(d, tc.at)
+		if name(last) != tc.last || name(next) != tc.next {
+			t.Errorf("at %v: want %v to %v, got %v to %v", tc.at.Format("15:04"), tc.last, tc.next, name(last), name(next))
+		}
+	}
+
+	if _, err := Trip(svc, "T1", tz); err != ErrNoTrip {
+		t.Errorf("want ErrNoTrip for an unknown trip, got %v", err)
+	}
+	svc.Endpoints.Trip = ""
+	if _, err := Trip(svc, id, tz); err != ErrNoTrip {
+		t.Errorf("want ErrNoTrip without a trip endpoint, got %v", err)
+	}
+}
+
+func TestApproaching(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, done := fakeAPI(t, "", `{"stop": {"name": "Stadelhofen"}, "connections": [
+	  {"time": "2018-03-05 12:03:00", "type": "tram", "line": "11", "terminal": {"name": "Rehalp"},
+	   "subsequent_stops": [{"name": "Bellevue", "dep": "2018-03-05 11:59:00"}]},
+	  {"time": "2018-03-05 12:09:00", "type": "tram", "line": "15", "terminal": {"name": "Bucheggplatz"}, "arr_delay": "+1",
+	   "subsequent_stops": [{"name": "Bucheggplatz", "dep": "2018-03-05 11:50:00"},
+	                        {"name": "Central", "arr": "2018-03-05 12:00:00", "dep": "2018-03-05 12:00:00"},
+	                        {"name": "Bellevue", "arr": "2018-03-05 12:04:00", "arr_delay": "+1", "dep": "2018-03-05 12:05:00"},
+	                        {"name": "Kunsthaus", "arr": "2018-03-05 12:07:00", "arr_delay": "+1", "dep": "2018-03-05 12:07:00"}]}]}`)
+	defer done()
+	now := time.Date(2018, time.March, 5, 12, 2, 0, 0, tz)
+
+	run, pos, err := Approaching(svc, Params{Source: "Stadelhofen", Route: []string{"15"}}, tz, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run == nil || run.From != "Bucheggplatz" || pos.Last == nil || pos.Last.Name != "Central" || pos.Next.Name != "Bellevue" {
+		t.Fatalf("want the 15 between Central and Bellevue, got %+v at %+v", run, pos)
+	}
+	// It's due at 12:10, three stops on.
+	if pos.StopsAway != 3 || pos.Minutes != 8 {
+		t.Errorf("want 3 stops and 8 minutes away, got %v and %v", pos.StopsAway, pos.Minutes)
+	}
+	// The 11 left Bellevue before now but hasn't arrived yet.
+	if run, pos, _ := Approaching(svc, Params{Source: "Stadelhofen", Route: []string{"11"}}, tz, now); run == nil || pos.StopsAway != 1 {
+		t.Errorf("want the 11 one stop away, got %+v at %+v", run, pos)
+	}
+
+	if _, ok := Locate(*run, "Stadelhofen", now.Add(10*time.Minute)); ok {
+		t.Error("want no position once it's left")
+	}
+}
+
+func TestStepFree(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	svc, done := fakeAPI(t, "", `{"stop": {"name": "Stadelhofen"}, "connections": [
+	  {"time": "2018-03-05 12:01:00", "type": "tram", "line": "11", "terminal": {"name": "Rehalp"}},
+	  {"time": "2018-03-05 12:03:00", "type": "tram", "line": "15", "terminal": {"name": "Klusplatz"}, "attributes": {"NF": "Niederflurfahrzeug"}},
+	  {"time": "2018-03-05 12:04:00", "type": "bus", "line": "912", "terminal": {"name": "Forch"}, "attributes": {"ZZ": "Plancher surbaissé"}}]}`)
+	defer done()
+
+	ds, err := Departures(svc, Params{Source: "Stadelhofen", StepFree: true}, tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].Name != "15" || ds[1].Name != "912" {
+		t.Errorf("want the 15 and 912, got %+v", ds)
+	}
+	if stepFree(map[string]string{"FS": "Familienwagen mit Spielplatz"}) {
+		t.Error("want a family coach not to be step-free")
+	}
+}
+
+func TestLeastCrowded(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	at := func(hhmm string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02 15:04", "2018-03-05 "+hhmm, tz)
+		return d
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/route.json", func(w http.ResponseWriter, r *http.Request) {
+		conn := func(dep, line string) string {
+			return fmt.Sprintf(`{"departure": "2018-03-05 %[1]v:00", "arrival": "2018-03-05 13:00:00",
+			  "legs": [{"departure": "2018-03-05 %[1]v:00", "type": "strain", "line": "%[2]v"}]}`, dep, line)
+		}
+		fmt.Fprintf(w, `{"connections": [%v, %v, %v, %v]}`, conn("12:02", "IC1"), conn("12:02", "S12"), conn("12:08", "IR36"), conn("12:32", "IC1"))
+	})
+	forecasts := 0
+	mux.HandleFunc("/connections", func(w http.ResponseWriter, r *http.Request) {
+		forecasts++
+		if got := r.URL.Query().Get("from"); got != "Zürich HB" {
+			t.Errorf("want from 'Zürich HB', got '%v'", got)
+		}
+		conn := func(dep, category, number string, capacity, legCapacity int) string {
+			ts := at(dep).Unix()
+			return fmt.Sprintf(`{"from": {"departureTimestamp": %[1]v}, "capacity1st": 1, "capacity2nd": %[4]v,
+			  "sections": [{"journey": {"category": %[2]q, "number": %[3]q, "capacity1st": 1, "capacity2nd": %[5]v}, "departure": {"departureTimestamp": %[1]v}},
+			               {"journey": null, "departure": {"departureTimestamp": %[1]v}}]}`, ts, category, number, capacity, legCapacity)
+		}
+		fmt.Fprintf(w, `{"connections": [%v, %v, %v]}`, conn("12:02", "IC", "1", 0, 3), conn("12:02", "S", "12", 0, 1), conn("12:32", "IC", "1", 1, 0))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	svc := transport.Transport{Client: srv.Client(), Endpoints: transport.Endpoints{Connections: srv.URL + "/route.json", Occupancy: srv.URL + "/connections"}}
+	departures := func(conns []Connection) string {
+		got := []string{}
+		for _, c := range conns {
+			got = append(got, c.Departing.Format("15:04")+" "+c.Legs[0].Name)
+		}
+		return strings.Join(got, ", ")
+	}
+
+	conns, err := Connections(svc, Params{Source: "Zürich HB", Destination: "Basel SBB", LeastCrowded: true, Limit: 3}, tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The S12 is quiet though the IC1 leaving the same minute is busy. The
+	// 12:08 has no forecast, so it's taken to be medium, and the busy IC1
+	// is over the limit.
+	if got, want := departures(conns), "12:02 S12, 12:32 IC1, 12:08 IR36"; got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if l := conns[1].Legs[0]; l.Occupancy1st != localize.OccupancyLow || l.Occupancy2nd != localize.OccupancyLow {
+		t.Errorf("want the connection's occupancy on its leg, got %v and %v", l.Occupancy1st, l.Occupancy2nd)
+	}
+	if forecasts != 1 {
+		t.Errorf("want 1 forecast request, got %v", forecasts)
+	}
+
+	// Otherwise, they're in order of time, without asking for forecasts.
+	if conns, err = Connections(svc, Params{Source: "Zürich HB", Destination: "Basel SBB", Limit: 3}, tz); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := departures(conns), "12:02 IC1, 12:02 S12, 12:08 IR36"; got != want || conns[0].Legs[0].Occupancy2nd != localize.OccupancyUnknown {
+		t.Errorf("want %v without forecasts, got %v, %+v", want, got, conns[0].Legs[0])
+	}
+	if forecasts != 1 {
+		t.Errorf("want no more forecast requests, got %v", forecasts-1)
+	}
+
+	// Or if there are none.
+	svc.Endpoints.Occupancy = ""
+	if conns, err = Connections(svc, Params{Source: "Zürich HB", Destination: "Basel SBB", LeastCrowded: true, Limit: 2}, tz); err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 2 || conns[0].Legs[0].Occupancy2nd != localize.OccupancyUnknown || !conns[0].Departing.Equal(at("12:02")) {
+		t.Errorf("want the 12:02 first without a forecast, got %+v", conns)
+	}
+}
+
+func TestFare(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("to") == "Basel SBB" {
+			fmt.Fprint(w, `{"connections": [{"departure": "2018-03-05 12:04:00", "arrival": "2018-03-05 13:00:00", "price": 51,
+			  "legs": [{"departure": "2018-03-05 12:04:00", "sbb_name": "Bern", "type": "express_train", "line": "IC6", "exit": {"sbb_name": "Basel SBB"}}]}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"connections": [{"departure": "2018-03-05 12:02:00", "arrival": "2018-03-05 12:19:00",
+		  "legs": [{"departure": "2018-03-05 12:02:00", "sbb_name": "Zürich HB", "type": "strain", "line": "S9",
+		    "stops": [{"name": "Zürich Stettbach"}, {"name": "Dübendorf"}], "exit": {"name": "Uster", "sbb_name": "Uster"}}]}]}`)
+	}))
+	defer srv.Close()
+	svc := transport.Transport{Client: srv.Client(), Endpoints: transport.Endpoints{Connections: srv.URL}}
+	tariffs := fares.NewTariffs([]fares.Network{{
+		Name:     "ZVV",
+		Stations: map[string][]string{"Zürich HB": {"110"}, "Zürich Stettbach": {"110", "121"}, "Dübendorf": {"121"}, "Uster": {"130"}},
+		Double:   []string{"110"},
+		Prices:   []fares.Price{{Full: 4.6, Half: 3.2}, {Full: 4.6, Half: 3.2}, {Full: 7, Half: 5}, {Full: 9.2, Half: 6.4}},
+	}})
+
+	for _, tc := range []struct {
+		to   string
+		want localize.Fare
+	}{
+		// The provider's price wins, and a half-fare card halves it.
+		{"Basel SBB", localize.Fare{Full: 51, Half: 25.5}},
+		// The city zone counts double and Stettbach is on its border.
+		{"Uster", localize.Fare{Full: 9.2, Half: 6.4, Network: "ZVV", Zones: 4}},
+	} {
+		f, err := Fare(svc, Params{Source: "Zürich HB", Destination: tc.to}, tariffs, tz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f == nil || *f != tc.want {
+			t.Errorf("%v: want %+v, got %+v", tc.to, tc.want, f)
+		}
+	}
+	if f, err := Fare(svc, Params{Source: "Zürich HB", Destination: "Uster"}, nil, tz); err != nil || f != nil {
+		t.Errorf("want no fare without tariffs, got %+v, %v", f, err)
+	}
+
+	// Walking to a stop the network doesn't have needs no ticket.
+	c := Connection{Legs: []localize.Departure{
+		{From: "Zürich HB", Mode: modes.Train, Stops: []localize.Stop{{Name: "Uster"}}},
+		{From: "Uster", Mode: modes.Walk, Stops: []localize.Stop{{Name: "Volketswil, Zentrum"}}},
+	}}
+	if f := Price(c, tariffs); f == nil || f.Zones != 3 {
+		t.Errorf("want the train's 3 zones, got %+v", f)
+	}
+}
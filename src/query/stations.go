@@ -0,0 +1,115 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gazetteer"
+	"transport"
+)
+
+const (
+	// minScore is the least Similarity for a station to be a candidate.
+	minScore = 0.6
+	// ambiguity is how close another candidate's score must be to the
+	// best one's for us to ask which was meant.
+	ambiguity = 0.06
+	// maxCandidates is how many stations we offer to choose from.
+	maxCandidates = 5
+)
+
+// Resolution is what a station name was resolved to.
+type Resolution struct {
+	// Station is the best match, or "" if nothing matched.
+	Station string
+	// Candidates are the stations to ask the user to choose from, if
+	// several match about as well; otherwise it's empty.
+	Candidates []string
+}
+
+// ResolveStation works out which station name means. It asks the
+// timetable API to complete name, leaving out locations whose icon class
+// starts with one of ignored, and, if ix isn't nil, searches it too, then
+// scores the stations found by their Similarity to name.
+func ResolveStation(svc transport.Transport, name string, ix *gazetteer.Index, ignored []string) (Resolution, error) {
+	if name == "" {
+		return Resolution{}, nil
+	}
+	if ix != nil {
+		if s, ok := ix.Lookup(name); ok {
+			return Resolution{Station: s.Name}, nil
+		}
+	}
+	scores := map[string]float64{}
+	order := []string{}
+	add := func(station string, score float64) {
+		if _, ok := scores[station]; !ok {
+			order = append(order, station)
+		}
+		if score > scores[station] {
+			scores[station] = score
+		}
+	}
+	lresp, err := svc.Locations(transport.LocationsRequest{Query: name})
+	if err != nil {
+		return Resolution{}, fmt.Errorf("Error calling Opendata: %v", err)
+	}
+	// "Bahnhof Oerlikon" is the railway station, not a stop nearby.
+	trainBonus := 0.0
+	if gazetteer.MentionsStation(name) {
+		trainBonus = 0.05
+	}
+	rank := 0
+	for _, l := range lresp {
+		if ignoredIconClass(l.Iconclass, ignored) || rank == 10 {
+			continue
+		}
+		if gazetteer.Normalize(l.Label) == gazetteer.Normalize(name) {
+			// Said exactly, so there's nothing to ask, whatever the
+			// API's ranking.
+			return Resolution{Station: l.Label}, nil
+		}
+		// The API's own ranking breaks ties.
+		score := gazetteer.Similarity(name, l.Label) - 0.001*float64(rank)
+		if strings.Contains(l.Iconclass, "train") {
+			score += trainBonus
+		}
+		add(l.Label, score)
+		rank++
+	}
+	if ix != nil {
+		for _, m := range ix.Search(name, minScore, 10) {
+			if m.Serves("train") {
+				m.Score += trainBonus
+			}
+			add(m.Name, m.Score)
+		}
+	}
+
+	candidates := []string{}
+	for _, s := range order {
+		if scores[s] >= minScore {
+			candidates = append(candidates, s)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return scores[candidates[i]] > scores[candidates[j]] })
+	if len(candidates) == 0 {
+		// Leave it to the API.
+		return Resolution{Station: name}, nil
+	}
+	r := Resolution{Station: candidates[0]}
+	if scores[candidates[0]] >= 1 {
+		return r, nil
+	}
+	nearest := candidates[:1]
+	for _, c := range candidates[1:] {
+		if scores[c] >= scores[candidates[0]]-ambiguity && len(nearest) < maxCandidates {
+			nearest = append(nearest, c)
+		}
+	}
+	if len(nearest) > 1 {
+		r.Candidates = nearest
+	}
+	return r, nil
+}
@@ -0,0 +1,68 @@
+package query
+
+import (
+	"time"
+
+	"gazetteer"
+	"localize"
+	"transport"
+)
+
+// sameStation is the least Similarity for a stop to be the station asked
+// about, e.g. "Uster" for "Bahnhof Uster".
+const sameStation = 0.9
+
+// StopAt returns where d stops at station on its way, if it does.
+func StopAt(d localize.Departure, station string) (localize.Stop, bool) {
+	if i := indexOf(d.Stops, station); i >= 0 {
+		return d.Stops[i], true
+	}
+	return localize.Stop{}, false
+}
+
+// indexOf returns the index of station in stops, or -1.
+func indexOf(stops []localize.Stop, station string) int {
+	n := gazetteer.Normalize(station)
+	for i, s := range stops {
+		if gazetteer.Normalize(s.Name) == n {
+			return i
+		}
+	}
+	for i, s := range stops {
+		// Both ways, so "Winterthur" isn't "Winterthur Grüze".
+		if gazetteer.Similarity(station, s.Name) >= sameStation && gazetteer.Similarity(s.Name, station) >= sameStation {
+			return i
+		}
+	}
+	return -1
+}
+
+// A Call says whether a departure stops at a station.
+type Call struct {
+	Departure localize.Departure
+	// Stop is where it stops there, if it does.
+	Stop *localize.Stop
+}
+
+// NextCall finds the next departure from p.Source matching p's modes and
+// routes, at or after p.Datetime, and whether it stops at station. It
+// returns nil if there's no such departure.
+func NextCall(svc transport.Transport, p Params, station string, tz *time.Location) (*Call, error) {
+	p.Via = ""
+	departures, err := stationboard(svc, p, tz)
+	if err != nil {
+		return nil, err
+	}
+	f := newFilter(p)
+	for _, d := range departures {
+		if !f.match(d) || d.Departing.Before(p.Datetime) {
+			continue
+		}
+		c := &Call{Departure: d}
+		if s, ok := StopAt(d, station); ok {
+			c.Stop = &s
+		}
+		return c, nil
+	}
+	return nil, nil
+}
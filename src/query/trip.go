@@ -0,0 +1,127 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"localize"
+	"modes"
+	"transport"
+)
+
+// ErrNoTrip is returned by Trip if the provider doesn't know the trip, or
+// there's nowhere to look it up.
+var ErrNoTrip = errors.New("no such trip")
+
+// Trip fetches the run with the given TripID, from its first stop, with the
+// rest as its Stops.
+func Trip(svc transport.Transport, id string, tz *time.Location) (localize.Departure, error) {
+	tresp, err := svc.Trip(id)
+	if err == transport.ErrNoTrips {
+		return localize.Departure{}, ErrNoTrip
+	} else if err != nil {
+		return localize.Departure{}, fmt.Errorf("Error calling Opendata: %v", err)
+	}
+	if len(tresp.PassList) == 0 {
+		return localize.Departure{}, ErrNoTrip
+	}
+	first := tresp.PassList[0]
+	d := localize.Departure{
+		From:         first.Station.Name,
+		Name:         journeyLine(tresp.Category, tresp.Number),
+		To:           tresp.To,
+		Mode:         modes.FromCategory(tresp.Category),
+		Departing:    timestamp(first.DepartureTimestamp, tz),
+		MinutesDelay: first.Delay,
+		Platform:     first.Platform,
+		TripID:       id,
+		Occupancy1st: occupancy(tresp.Capacity1st, 0),
+		Occupancy2nd: occupancy(tresp.Capacity2nd, 0),
+	}
+	if p := first.Prognosis.Platform; p != "" && p != first.Platform {
+		d.Platform, d.PlatformChanged, d.ScheduledPlatform = p, true, first.Platform
+	}
+	if d.To == "" {
+		d.To = tresp.PassList[len(tresp.PassList)-1].Station.Name
+	}
+	for _, s := range tresp.PassList[1:] {
+		stop := localize.Stop{
+			Name:         s.Station.Name,
+			Arriving:     timestamp(s.ArrivalTimestamp, tz),
+			Departing:    timestamp(s.DepartureTimestamp, tz),
+			MinutesDelay: s.Delay,
+			Platform:     s.Platform,
+		}
+		if s.Prognosis.Platform != "" {
+			stop.Platform = s.Prognosis.Platform
+		}
+		d.Stops = append(d.Stops, stop)
+	}
+	return d, nil
+}
+
+// journeyLine names an opendata.ch journey's line as search.ch does: "S5"
+// or "IC1" for trains, but just "4" for the number 4 tram.
+func journeyLine(category, number string) string {
+	if number == "" || modes.FromCategory(category) == modes.Train {
+		return category + number
+	}
+	return number
+}
+
+// timestamp is the Unix time ts in tz, or zero if ts is 0.
+func timestamp(ts int64, tz *time.Location) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0).In(tz)
+}
+
+// AllStops returns d's stops including From.
+func AllStops(d localize.Departure) []localize.Stop {
+	return append([]localize.Stop{{
+		Name:         d.From,
+		Departing:    d.Departing,
+		MinutesDelay: d.MinutesDelay,
+		Platform:     d.Platform,
+	}}, d.Stops...)
+}
+
+// Progress finds where d is at t from its timetable and delays: the stop
+// it last left and the next it stops at. last is nil if it hasn't left
+// From yet, when next is where it leaves from, and next is nil once it's
+// arrived at its terminal. If it's standing at a stop, both are that stop.
+func Progress(d localize.Departure, t time.Time) (last, next *localize.Stop) {
+	stops := AllStops(d)
+	i, j := progress(stops, t)
+	if i >= 0 {
+		last = &stops[i]
+	}
+	if j >= 0 {
+		next = &stops[j]
+	}
+	return last, next
+}
+
+// progress is Progress by index into stops, with -1 for nil.
+func progress(stops []localize.Stop, t time.Time) (last, next int) {
+	last = -1
+	for i, s := range stops {
+		if arr := s.ExpectedArrival(); !arr.IsZero() && t.Before(arr) {
+			return last, i
+		}
+		if dep := s.ExpectedDeparture(); dep.IsZero() || t.Before(dep) {
+			if i == 0 {
+				return -1, i
+			}
+			if dep.IsZero() {
+				// The terminal.
+				return i, -1
+			}
+			return i, i
+		}
+		last = i
+	}
+	return last, -1
+}
@@ -2,6 +2,7 @@ package transport
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -15,8 +16,33 @@ const (
 )
 
 type Transport struct {
-	Client *http.Client
-	Logger func(string)
+	Client    *http.Client
+	Logger    func(string)
+	Endpoints Endpoints
+}
+
+// Endpoints are the timetable API URLs. Empty fields use the search.ch
+// defaults.
+type Endpoints struct {
+	Stationboard string
+	Connections  string
+	Locations    string
+	// Occupancy is transport.opendata.ch's connections API, which has the
+	// occupancy forecasts search.ch doesn't. Without it there are none.
+	Occupancy string
+	// Trip is transport.opendata.ch's journey API, which looks up a trip
+	// by the tripid of a connection leg. Without it there are no trips.
+	Trip string
+}
+
+// ErrNoTrips is returned by Trip if there's no trip endpoint.
+var ErrNoTrips = errors.New("no trip endpoint configured")
+
+func endpoint(configured, def string) string {
+	if configured != "" {
+		return configured
+	}
+	return def
 }
 
 func (t *Transport) dispatch(endpoint string, params map[string]string, result interface{}) error {
@@ -55,7 +81,7 @@ func (t *Transport) Locations(req LocationsRequest) (LocationsResponse, error) {
 	}
 
 	var resp LocationsResponse
-	err := t.dispatch(locationsEndpoint, params, &resp)
+	err := t.dispatch(endpoint(t.Endpoints.Locations, locationsEndpoint), params, &resp)
 	return resp, err
 }
 
@@ -82,7 +108,7 @@ func (t *Transport) Stationboard(req StationboardRequest) (StationboardResponse,
 	params["show_trackchanges"] = "true"
 
 	var resp StationboardResponse
-	err := t.dispatch(stationboardEndpoint, params, &resp)
+	err := t.dispatch(endpoint(t.Endpoints.Stationboard, stationboardEndpoint), params, &resp)
 	return resp, err
 }
 
@@ -104,10 +130,56 @@ func (t *Transport) Connections(req ConnectionsRequest) (ConnectionsResponse, er
 		params["date"] = req.Datetime.Format("2006-01-02")
 		params["time"] = req.Datetime.Format("15:04")
 	}
+	if req.ArriveBy {
+		params["time_type"] = "arrival"
+	}
 	params["show_delays"] = "true"
 	params["show_trackchanges"] = "true"
 
 	var resp ConnectionsResponse
-	err := t.dispatch(connectionsEndpoint, params, &resp)
+	err := t.dispatch(endpoint(t.Endpoints.Connections, connectionsEndpoint), params, &resp)
+	return resp, err
+}
+
+// Occupancy fetches the same connections as Connections from Occupancy, for
+// their occupancy forecasts.
+func (t *Transport) Occupancy(req ConnectionsRequest) (OccupancyResponse, error) {
+	var resp OccupancyResponse
+	if t.Endpoints.Occupancy == "" {
+		return resp, nil
+	}
+	params := map[string]string{}
+	if req.Station != "" {
+		params["from"] = req.Station
+	}
+	if req.Destination != "" {
+		params["to"] = req.Destination
+	}
+	if req.Via != "" {
+		params["via[]"] = req.Via
+	}
+	if req.Limit != 0 {
+		params["limit"] = strconv.Itoa(req.Limit)
+	}
+	if !req.Datetime.IsZero() {
+		params["date"] = req.Datetime.Format("2006-01-02")
+		params["time"] = req.Datetime.Format("15:04")
+	}
+	if req.ArriveBy {
+		params["isArrivalTime"] = "1"
+	}
+	err := t.dispatch(t.Endpoints.Occupancy, params, &resp)
+	return resp, err
+}
+
+// Trip fetches the trip with the given ID, as given by a connection leg,
+// with all its stops.
+func (t *Transport) Trip(tripID string) (TripResponse, error) {
+	var resp TripResponse
+	if t.Endpoints.Trip == "" {
+		return resp, ErrNoTrips
+	}
+	params := map[string]string{"id": tripID}
+	err := t.dispatch(t.Endpoints.Trip, params, &resp)
 	return resp, err
 }
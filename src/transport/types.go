@@ -11,6 +11,45 @@ const (
 	DEPARTURE = iota
 )
 
+// A Disruption is a service message, e.g. about construction work or an
+// accident.
+type Disruption struct {
+	ID     string `json:"id"`
+	Header string `json:"header"`
+	Lead   string `json:"lead,omitempty"`
+	Text   string `json:"text,omitempty"`
+	// Timerange is when it applies, e.g. "20.10.2026 05:00 - 25.10.2026
+	// 23:59", if known.
+	Timerange string `json:"timerange,omitempty"`
+	Priority  int    `json:"priority,omitempty"`
+}
+
+// Disruptions are the disruptions affecting a departure or connection, by
+// ID.
+type Disruptions map[string]Disruption
+
+// UnmarshalJSON accepts an empty list for no disruptions, as the API sends.
+func (ds *Disruptions) UnmarshalJSON(bs []byte) error {
+	var list []Disruption
+	if err := json.Unmarshal(bs, &list); err == nil {
+		*ds = Disruptions{}
+		for _, d := range list {
+			id := d.ID
+			if id == "" {
+				id = d.Header
+			}
+			(*ds)[id] = d
+		}
+		return nil
+	}
+	m := map[string]Disruption{}
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return err
+	}
+	*ds = Disruptions(m)
+	return nil
+}
+
 type StationboardRequest struct {
 	Station  string
 	Limit    int
@@ -40,16 +79,25 @@ type StationboardResponse struct {
 			X    json.Number `json:"x"`
 			Y    json.Number `json:"y"`
 		} `json:"terminal"`
+		// SubsequentStops are the stops after this one, or before it on
+		// an arrivals board.
 		SubsequentStops []struct {
-			ID  string      `json:"id"`
-			X   json.Number `json:"x"`
-			Y   json.Number `json:"y"`
-			Arr string      `json:"arr"`
-			Dep string      `json:"dep,omitempty"`
+			ID   string      `json:"id"`
+			Name string      `json:"name"`
+			X    json.Number `json:"x"`
+			Y    json.Number `json:"y"`
+			Arr  string      `json:"arr"`
+			Dep  string      `json:"dep,omitempty"`
+			// ArrDelay and DepDelay are like the connection's.
+			ArrDelay string `json:"arr_delay,omitempty"`
+			DepDelay string `json:"dep_delay,omitempty"`
 		} `json:"subsequent_stops"`
-		Track    string `json:"track,omitempty"`
-		ArrDelay string `json:"arr_delay,omitempty"`
-		DepDelay string `json:"dep_delay,omitempty"`
+		Track       string      `json:"track,omitempty"`
+		ArrDelay    string      `json:"arr_delay,omitempty"`
+		DepDelay    string      `json:"dep_delay,omitempty"`
+		Disruptions Disruptions `json:"disruptions,omitempty"`
+		// Attributes are service notes by code, as on connection legs.
+		Attributes map[string]string `json:"attributes,omitempty"`
 	} `json:"connections"`
 	Request string `json:"request"`
 	EOF     int    `json:"eof"`
@@ -73,6 +121,7 @@ type ConnectionsRequest struct {
 	Via         string
 	Limit       int
 	Datetime    time.Time
+	ArriveBy    bool // If true, Datetime is the arrival time.
 }
 
 type ConnectionsResponse struct {
@@ -86,7 +135,12 @@ type ConnectionsResponse struct {
 		To        string      `json:"to"`
 		Arrival   string      `json:"arrival"`
 		Duration  json.Number `json:"duration"`
-		Legs      []struct {
+		// Disruptions affect the whole connection.
+		Disruptions Disruptions `json:"disruptions,omitempty"`
+		// Price is the full 2nd class fare in CHF, if the provider gives
+		// one.
+		Price float64 `json:"price,omitempty"`
+		Legs  []struct {
 			Departure string      `json:"departure,omitempty"`
 			Tripid    string      `json:"tripid,omitempty"`
 			Number    string      `json:"number,omitempty"`
@@ -130,6 +184,10 @@ type ConnectionsResponse struct {
 			Waittime   int    `json:"waittime,omitempty"`
 			NormalTime int    `json:"normal_time,omitempty"`
 			Isaddress  bool   `json:"isaddress,omitempty"`
+			// Attributes are service notes by code, e.g. a night
+			// supplement.
+			Attributes  map[string]string `json:"attributes,omitempty"`
+			Disruptions Disruptions       `json:"disruptions,omitempty"`
 		} `json:"legs"`
 	} `json:"connections"`
 	URL    string `json:"url"`
@@ -144,3 +202,60 @@ type ConnectionsResponse struct {
 	Request     string `json:"request"`
 	EOF         int    `json:"eof"`
 }
+
+// OccupancyResponse is the part of transport.opendata.ch's connections
+// response with the occupancy forecasts. Capacity1st and Capacity2nd are
+// from 1 (low) to 3 (high), or 0 if unknown.
+type OccupancyResponse struct {
+	Connections []struct {
+		From struct {
+			DepartureTimestamp int64 `json:"departureTimestamp"`
+		} `json:"from"`
+		Capacity1st int `json:"capacity1st"`
+		Capacity2nd int `json:"capacity2nd"`
+		Sections    []struct {
+			// Journey is null for walks.
+			Journey *struct {
+				Name string `json:"name"`
+				// Category and Number make up the line, as for
+				// TripResponse.
+				Category    string `json:"category"`
+				Number      string `json:"number"`
+				Capacity1st int    `json:"capacity1st"`
+				Capacity2nd int    `json:"capacity2nd"`
+			} `json:"journey"`
+			Departure struct {
+				DepartureTimestamp int64 `json:"departureTimestamp"`
+			} `json:"departure"`
+		} `json:"sections"`
+	} `json:"connections"`
+}
+
+// TripResponse is transport.opendata.ch's journey: a vehicle's whole run,
+// from its first stop to its terminal. Timestamps are Unix times, or 0 if
+// there's no such time, like the departure from the terminal.
+type TripResponse struct {
+	Name string `json:"name"`
+	// Category and Number make up the line, e.g. "S" and "5".
+	Category string `json:"category"`
+	Number   string `json:"number"`
+	Operator string `json:"operator"`
+	To       string `json:"to"`
+	PassList []struct {
+		Station struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"station"`
+		ArrivalTimestamp   int64 `json:"arrivalTimestamp"`
+		DepartureTimestamp int64 `json:"departureTimestamp"`
+		// Delay is in minutes.
+		Delay     int    `json:"delay"`
+		Platform  string `json:"platform"`
+		Prognosis struct {
+			// Platform is set if it's changed.
+			Platform string `json:"platform"`
+		} `json:"prognosis"`
+	} `json:"passList"`
+	Capacity1st int `json:"capacity1st"`
+	Capacity2nd int `json:"capacity2nd"`
+}
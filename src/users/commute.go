@@ -0,0 +1,82 @@
+package users
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultCommute is the name of the commute asked for with just "my commute".
+const DefaultCommute = "commute"
+
+// A Commute is a regular trip, so "my commute" can stand for "the next tram
+// 4 from Stadelhofen to Bellevue".
+type Commute struct {
+	Source      string   `json:"source"`
+	Destination string   `json:"destination,omitempty"`
+	Transport   []string `json:"transport,omitempty"`
+	Route       []string `json:"route,omitempty"`
+	// Start and End are the local times ("15:04") the commute usually
+	// starts between. Without a Start, it can start any time.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// clock returns the time hhmm on the day of t.
+func clock(t time.Time, hhmm string) (time.Time, error) {
+	c, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), c.Hour(), c.Minute(), 0, 0, t.Location()), nil
+}
+
+// Next returns when to look for departures from, if it's now: the zero time
+// while the commute's window is open, or else the start of the next window.
+func (c Commute) Next(now time.Time) time.Time {
+	start, err := clock(now, c.Start)
+	if err != nil {
+		return time.Time{}
+	}
+	end := start
+	if c.End != "" {
+		if end, err = clock(now, c.End); err != nil {
+			end = start
+		}
+	}
+	if end.Before(start) {
+		// The window spans midnight, e.g. 23:00-01:00.
+		if !now.Before(start) || now.Before(end) {
+			return time.Time{}
+		}
+		return start
+	}
+	switch {
+	case now.Before(start):
+		return start
+	case !now.After(end):
+		return time.Time{}
+	}
+	start, _ = clock(now.AddDate(0, 0, 1), c.Start)
+	return start
+}
+
+// SaveCommute remembers c under name, replacing what was there.
+func (u *User) SaveCommute(name string, c Commute) {
+	if u.Commutes == nil {
+		u.Commutes = map[string]Commute{}
+	}
+	u.Commutes[commuteName(name)] = c
+}
+
+// Commute returns the named commute, and whether there is one.
+func (u User) Commute(name string) (Commute, bool) {
+	c, ok := u.Commutes[commuteName(name)]
+	return c, ok
+}
+
+func commuteName(name string) string {
+	if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+		return DefaultCommute
+	}
+	return name
+}
@@ -0,0 +1,69 @@
+package users
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommuteNext(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Zurich")
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2018, time.March, day, hour, min, 0, 0, tz)
+	}
+	morning := Commute{Start: "07:00", End: "08:30"}
+	night := Commute{Start: "23:30", End: "00:30"}
+	for _, tc := range []struct {
+		c    Commute
+		now  time.Time
+		want time.Time
+	}{
+		{Commute{}, at(5, 7, 0), time.Time{}},
+		{morning, at(5, 6, 0), at(5, 7, 0)},
+		{morning, at(5, 7, 30), time.Time{}},
+		{morning, at(5, 8, 30), time.Time{}},
+		{morning, at(5, 9, 0), at(6, 7, 0)},
+		// Tomorrow's window starts at 07:00 even though the clocks change
+		// tonight.
+		{morning, at(24, 9, 0), at(25, 7, 0)},
+		{night, at(5, 23, 45), time.Time{}},
+		{night, at(6, 0, 15), time.Time{}},
+		{night, at(5, 12, 0), at(5, 23, 30)},
+		{Commute{Start: "07:00"}, at(5, 7, 1), at(6, 7, 0)},
+	} {
+		if got := tc.c.Next(tc.now); !got.Equal(tc.want) {
+			t.Errorf("%v at %v: want %v, got %v", tc.c, tc.now, tc.want, got)
+		}
+	}
+}
+
+func TestSaveCommute(t *testing.T) {
+	u := User{}
+	u.SaveCommute("", Commute{Source: "Stadelhofen", Destination: "Bellevue"})
+	u.SaveCommute("Morning", Commute{Source: "Uster", Destination: "Zürich HB"})
+	if c, ok := u.Commute(DefaultCommute); !ok || c.Source != "Stadelhofen" {
+		t.Errorf("want Stadelhofen, got %v, %v", c, ok)
+	}
+	if c, ok := u.Commute("morning"); !ok || c.Source != "Uster" {
+		t.Errorf("want Uster, got %v, %v", c, ok)
+	}
+	if _, ok := u.Commute("evening"); ok {
+		t.Error("want no evening commute")
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	for _, tc := range []struct {
+		values []string
+		want   []time.Weekday
+	}{
+		{nil, nil},
+		{[]string{"daily"}, nil},
+		{[]string{"weekend"}, []time.Weekday{time.Saturday, time.Sunday}},
+		{[]string{"Monday", "friday", "monday"}, []time.Weekday{time.Monday, time.Friday}},
+	} {
+		if got := ParseDays(tc.values); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: want %v, got %v", tc.values, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+//go:build appengine
+// +build appengine
+
+package users
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// Datastore is a Store backed by the App Engine Datastore. ctx must be an
+// App Engine request context.
+type Datastore struct {
+	// Kind is the entity kind users are stored as. Defaults to "User".
+	Kind string
+}
+
+// entity holds a User as JSON, since Datastore can't store maps.
+type entity struct {
+	Data []byte `datastore:",noindex"`
+}
+
+func (d Datastore) key(ctx context.Context, id string) *datastore.Key {
+	kind := d.Kind
+	if kind == "" {
+		kind = "User"
+	}
+	return datastore.NewKey(ctx, kind, id, 0, nil)
+}
+
+func (d Datastore) Get(ctx context.Context, id string) (User, error) {
+	e := entity{}
+	if err := datastore.Get(ctx, d.key(ctx, id), &e); err == datastore.ErrNoSuchEntity {
+		return User{}, nil
+	} else if err != nil {
+		return User{}, err
+	}
+	u := User{}
+	err := json.Unmarshal(e.Data, &u)
+	return u, err
+}
+
+func (d Datastore) Each(ctx context.Context, f func(id string, u User) error) error {
+	it := datastore.NewQuery(d.key(ctx, "").Kind()).Run(ctx)
+	for {
+		e := entity{}
+		k, err := it.Next(&e)
+		if err == datastore.Done {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		u := User{}
+		if err := json.Unmarshal(e.Data, &u); err != nil {
+			return err
+		}
+		if err := f(k.StringID(), u); err != nil {
+			return err
+		}
+	}
+}
+
+func (d Datastore) Put(ctx context.Context, id string, u User) error {
+	bs, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = datastore.Put(ctx, d.key(ctx, id), &entity{Data: bs})
+	return err
+}
+
+func (d Datastore) Update(ctx context.Context, id string, f func(u *User) error) error {
+	return datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		u, err := d.Get(tc, id)
+		if err != nil {
+			return err
+		}
+		if err := f(&u); err != nil {
+			return err
+		}
+		return d.Put(tc, id, u)
+	}, nil)
+}
@@ -0,0 +1,105 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is a Store which keeps all users in one JSON file. It's meant for a
+// single sbb-server process; the file is rewritten on every Put.
+type File struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]User
+}
+
+// OpenFile loads the users in path, which is created on the first Put if it
+// doesn't exist.
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path, users: map[string]User{}}
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, &f.users); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Get(_ context.Context, id string) (User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return clone(f.users[id]), nil
+}
+
+func (f *File) Put(_ context.Context, id string, u User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.put(id, u)
+}
+
+func (f *File) Update(_ context.Context, id string, fn func(u *User) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := clone(f.users[id])
+	if err := fn(&u); err != nil {
+		return err
+	}
+	return f.put(id, u)
+}
+
+// put saves u, and puts back what was there if it can't. f.mu must be held.
+func (f *File) put(id string, u User) error {
+	old, existed := f.users[id]
+	f.users[id] = clone(u)
+	if err := f.save(); err != nil {
+		if existed {
+			f.users[id] = old
+		} else {
+			delete(f.users, id)
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *File) Each(ctx context.Context, fn func(id string, u User) error) error {
+	f.mu.Lock()
+	all := snapshot(f.users)
+	f.mu.Unlock()
+	for id, u := range all {
+		if err := fn(id, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes the users to a temporary file and renames it over path, so a
+// crash never leaves a truncated file behind.
+func (f *File) save() error {
+	bs, err := json.MarshalIndent(f.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,104 @@
+package users
+
+import (
+	"strings"
+	"time"
+)
+
+// A Subscription is a regular journey to send alerts about, e.g. the S12 at
+// 07:42 from Winterthur on weekdays.
+type Subscription struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	// Route is the line, e.g. "S12". Empty means whatever leaves at
+	// Departs.
+	Route string `json:"route,omitempty"`
+	// Departs is the scheduled local departure time from Source, "15:04".
+	Departs string `json:"departs"`
+	// Days are the days the journey is made. Empty means every day.
+	Days []time.Weekday `json:"days,omitempty"`
+	// MinDelay is the delay in minutes worth an alert. Zero means the
+	// default.
+	MinDelay int `json:"min_delay,omitempty"`
+	// Platform is the platform the journey usually leaves from, as last
+	// seen unchanged, so alerts can say which platform it's instead of.
+	Platform string `json:"platform,omitempty"`
+	// Lang is the language to send alerts in.
+	Lang string `json:"lang,omitempty"`
+	// Notified are the alerts already sent today, so they aren't sent
+	// again.
+	Notified []string `json:"notified,omitempty"`
+}
+
+// Scheduled returns the departure on the day of now, and whether the journey
+// is made that day.
+func (s Subscription) Scheduled(now time.Time) (time.Time, bool) {
+	t, err := clock(now, s.Departs)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if len(s.Days) == 0 {
+		return t, true
+	}
+	for _, d := range s.Days {
+		if d == now.Weekday() {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Same returns whether s and o are alerts for the same journey.
+func (s Subscription) Same(o Subscription) bool {
+	return strings.EqualFold(s.Source, o.Source) &&
+		strings.EqualFold(s.Route, o.Route) &&
+		s.Departs == o.Departs
+}
+
+// Subscribe adds s, replacing any subscription for the same journey.
+func (u *User) Subscribe(s Subscription) {
+	for i, o := range u.Subscriptions {
+		if o.Same(s) {
+			u.Subscriptions[i] = s
+			return
+		}
+	}
+	u.Subscriptions = append(u.Subscriptions, s)
+}
+
+// ParseDays parses the values of the Dialogflow @days entity: "weekdays",
+// "weekend", "daily" or day names like "monday".
+func ParseDays(values []string) []time.Weekday {
+	days := []time.Weekday{}
+	add := func(ds ...time.Weekday) {
+		for _, d := range ds {
+			dup := false
+			for _, e := range days {
+				dup = dup || e == d
+			}
+			if !dup {
+				days = append(days, d)
+			}
+		}
+	}
+	for _, v := range values {
+		switch v = strings.ToLower(v); v {
+		case "daily":
+			return nil
+		case "weekdays":
+			add(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+		case "weekend":
+			add(time.Saturday, time.Sunday)
+		default:
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				if strings.ToLower(d.String()) == v {
+					add(d)
+				}
+			}
+		}
+	}
+	if len(days) == 0 {
+		return nil
+	}
+	return days
+}
@@ -0,0 +1,166 @@
+// Package users stores what we remember about a user between conversations:
+// favorite stations, named places like "home" and "work", commutes, and
+// journeys to send delay alerts about.
+//
+// Users are identified by the opaque user ID Actions on Google sends with
+// each request. The store is pluggable: Memory for tests and local runs, File
+// for a single server, and Datastore on App Engine.
+package users
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Named places understood by the Dialogflow @place entity.
+const (
+	Home = "home"
+	Work = "work"
+)
+
+type User struct {
+	// Favorites are station names, most recently saved first.
+	Favorites []string `json:"favorites,omitempty"`
+	// Places maps place names like "home" to station names.
+	Places map[string]string `json:"places,omitempty"`
+	// Commutes are saved trips by name, e.g. "commute" or "morning".
+	Commutes map[string]Commute `json:"commutes,omitempty"`
+	// Subscriptions are the journeys to send alerts about.
+	Subscriptions []Subscription `json:"subscriptions,omitempty"`
+}
+
+// SavePlace remembers station as the named place, replacing what was there.
+func (u *User) SavePlace(place, station string) {
+	if u.Places == nil {
+		u.Places = map[string]string{}
+	}
+	u.Places[strings.ToLower(place)] = station
+}
+
+// Place returns the station saved as the named place, or "" if there isn't
+// one.
+func (u User) Place(place string) string {
+	return u.Places[strings.ToLower(place)]
+}
+
+// AddFavorite moves station to the front of the favorites, adding it if
+// needed.
+func (u *User) AddFavorite(station string) {
+	favs := []string{station}
+	for _, f := range u.Favorites {
+		if !strings.EqualFold(f, station) {
+			favs = append(favs, f)
+		}
+	}
+	u.Favorites = favs
+}
+
+// Resolve returns the station saved as name if name is a place, or name
+// itself otherwise.
+func (u User) Resolve(name string) string {
+	if s := u.Place(name); s != "" {
+		return s
+	}
+	return name
+}
+
+// A Store loads and saves users by ID.
+type Store interface {
+	// Get returns the user with the given ID, or the zero User if we don't
+	// know them yet.
+	Get(ctx context.Context, id string) (User, error)
+	Put(ctx context.Context, id string, u User) error
+	// Update calls f with the user with the given ID and saves what f
+	// leaves, with no other change to them in between. Nothing is saved if
+	// f returns an error.
+	Update(ctx context.Context, id string, f func(u *User) error) error
+	// Each calls f with every user, stopping at the first error. f may
+	// Put the user it's called with.
+	Each(ctx context.Context, f func(id string, u User) error) error
+}
+
+// Memory is a Store which forgets everything on restart.
+type Memory struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+func NewMemory() *Memory {
+	return &Memory{users: map[string]User{}}
+}
+
+func (m *Memory) Get(_ context.Context, id string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return clone(m.users[id]), nil
+}
+
+func (m *Memory) Put(_ context.Context, id string, u User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[id] = clone(u)
+	return nil
+}
+
+func (m *Memory) Update(_ context.Context, id string, f func(u *User) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := clone(m.users[id])
+	if err := f(&u); err != nil {
+		return err
+	}
+	m.users[id] = clone(u)
+	return nil
+}
+
+func (m *Memory) Each(ctx context.Context, f func(id string, u User) error) error {
+	m.mu.Lock()
+	all := snapshot(m.users)
+	m.mu.Unlock()
+	for id, u := range all {
+		if err := f(id, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot copies users, so they can be iterated over without holding a
+// lock.
+func snapshot(users map[string]User) map[string]User {
+	all := map[string]User{}
+	for id, u := range users {
+		all[id] = clone(u)
+	}
+	return all
+}
+
+// clone copies u so callers can't change stored users behind our back.
+func clone(u User) User {
+	c := User{}
+	if u.Favorites != nil {
+		c.Favorites = append([]string{}, u.Favorites...)
+	}
+	if u.Places != nil {
+		c.Places = map[string]string{}
+		for k, v := range u.Places {
+			c.Places[k] = v
+		}
+	}
+	if u.Commutes != nil {
+		c.Commutes = map[string]Commute{}
+		for k, v := range u.Commutes {
+			v.Transport = append([]string(nil), v.Transport...)
+			v.Route = append([]string(nil), v.Route...)
+			c.Commutes[k] = v
+		}
+	}
+	for _, s := range u.Subscriptions {
+		s.Days = append([]time.Weekday(nil), s.Days...)
+		s.Notified = append([]string(nil), s.Notified...)
+		c.Subscriptions = append(c.Subscriptions, s)
+	}
+	return c
+}
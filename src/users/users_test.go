@@ -0,0 +1,136 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	u := User{}
+	u.SavePlace("Home", "Stadelhofen")
+	if got := u.Resolve("home"); got != "Stadelhofen" {
+		t.Errorf("want 'Stadelhofen', got '%v'", got)
+	}
+	if got := u.Resolve("Zürich HB"); got != "Zürich HB" {
+		t.Errorf("want 'Zürich HB', got '%v'", got)
+	}
+	u.AddFavorite("Zürich HB")
+	u.AddFavorite("Bern")
+	u.AddFavorite("zürich hb")
+	if want := []string{"zürich hb", "Bern"}; !reflect.DeepEqual(u.Favorites, want) {
+		t.Errorf("want %v, got %v", want, u.Favorites)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	u, err := m.Get(ctx, "u1")
+	if err != nil || !reflect.DeepEqual(u, User{}) {
+		t.Fatalf("want zero user, got %v, %v", u, err)
+	}
+	u.SavePlace(Work, "Oerlikon")
+	if err := m.Put(ctx, "u1", u); err != nil {
+		t.Fatal(err)
+	}
+	// Changing our copy mustn't change the stored user.
+	u.SavePlace(Work, "Altstetten")
+	if got, _ := m.Get(ctx, "u1"); got.Place(Work) != "Oerlikon" {
+		t.Errorf("want 'Oerlikon', got '%v'", got.Place(Work))
+	}
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.json")
+
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("want nil, got '%v'", err)
+	}
+	u := User{}
+	u.SavePlace(Home, "Stadelhofen")
+	u.AddFavorite("Zürich HB")
+	if err := f.Put(ctx, "u1", u); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new store sees what the old one saved.
+	f, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Get(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, u) {
+		t.Errorf("want %v, got %v", u, got)
+	}
+}
+
+func TestEach(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	for _, id := range []string{"u1", "u2"} {
+		if err := m.Put(ctx, id, User{Favorites: []string{id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := map[string]bool{}
+	err := m.Each(ctx, func(id string, u User) error {
+		seen[id] = true
+		// Saving while iterating mustn't deadlock.
+		u.AddFavorite("Bern")
+		return m.Put(ctx, id, u)
+	})
+	if err != nil || len(seen) != 2 {
+		t.Errorf("want u1 and u2, got %v, %v", seen, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f, err := OpenFile(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Store{NewMemory(), f} {
+		if err := s.Put(ctx, "u1", User{Favorites: []string{"Bern"}}); err != nil {
+			t.Fatal(err)
+		}
+		err := s.Update(ctx, "u1", func(u *User) error {
+			u.SavePlace(Home, "Stadelhofen")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Nothing's saved if f fails.
+		if err := s.Update(ctx, "u1", func(u *User) error {
+			u.Favorites = nil
+			return errors.New("failed")
+		}); err == nil {
+			t.Errorf("want the error, got nil")
+		}
+		got, _ := s.Get(ctx, "u1")
+		if want := (User{Favorites: []string{"Bern"}, Places: map[string]string{Home: "Stadelhofen"}}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: want %v, got %v", s, want, got)
+		}
+	}
+}
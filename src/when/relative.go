@@ -0,0 +1,142 @@
+package when
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	nowWords = map[string]bool{"now": true, "right now": true, "jetzt": true, "sofort": true, "gleich": true}
+
+	// "in 20 minutes", "in an hour", "in einer halben Stunde".
+	inDuration = regexp.MustCompile(`^in (\d+|a|an|one|half an|einer|einem|eine|einer halben) ?(minutes?|mins?|hours?|h|minuten|stunden?)$`)
+
+	// "7", "7:30", "19.30", "7pm", "19 uhr", "19h"; the hour is required to
+	// follow "at"/"um" unless it has minutes or a suffix.
+	clockTime = regexp.MustCompile(`(?:^|\s)(at |um )?(\d{1,2})(?:[:.h](\d{2}))? ?(am|pm|uhr|h)?(?:\s|$)`)
+
+	weekdays = map[string]time.Weekday{
+		"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+		"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+		"sonntag": time.Sunday, "montag": time.Monday, "dienstag": time.Tuesday, "mittwoch": time.Wednesday,
+		"donnerstag": time.Thursday, "freitag": time.Friday, "samstag": time.Saturday, "sonnabend": time.Saturday,
+	}
+)
+
+// A part of the day, as hours from midnight.
+type part struct {
+	start, end int
+	// pm is whether hours before 12 mean the afternoon, e.g. "evening at
+	// 7".
+	pm bool
+}
+
+var (
+	morning   = part{5, 12, false}
+	afternoon = part{12, 18, true}
+	evening   = part{18, 23, true}
+	night     = part{21, 28, true}
+
+	parts = map[string]part{
+		"morning": morning, "früh": morning, "morgens": morning, "vormittag": morning, "vormittags": morning,
+		"afternoon": afternoon, "nachmittag": afternoon, "nachmittags": afternoon,
+		"evening": evening, "abend": evening, "abends": evening,
+		"night": night, "nacht": night, "nachts": night,
+	}
+)
+
+// relative resolves expressions like "in 20 minutes", "tomorrow morning",
+// "tonight", "on Saturday at 7" or "morgen um 7.30".
+func (r Resolver) relative(raw string, now time.Time) (Range, error) {
+	s := strings.Join(strings.Fields(strings.ToLower(strings.Trim(raw, " .?!"))), " ")
+	if nowWords[s] {
+		return Range{now, now}, nil
+	}
+	if m := inDuration.FindStringSubmatch(s); m != nil {
+		return Range{now.Add(duration(m[1], m[2])), now.Add(duration(m[1], m[2]))}, nil
+	}
+
+	days, haveDay := 0, false
+	var p *part
+	words := strings.Fields(s)
+	for i, w := range words {
+		switch {
+		case w == "today" || w == "heute":
+			haveDay = true
+		case w == "tonight":
+			haveDay, p = true, &evening
+		case w == "tomorrow" || w == "übermorgen":
+			days, haveDay = 1, true
+			if w == "übermorgen" || (i >= 2 && words[i-2] == "day" && words[i-1] == "after") {
+				days = 2
+			}
+		case w == "morgen":
+			// "heute morgen" is this morning; otherwise it's
+			// tomorrow, as in "morgen früh".
+			if i > 0 && words[i-1] == "heute" {
+				p = &morning
+			} else {
+				days, haveDay = 1, true
+			}
+		default:
+			if d, ok := weekdays[w]; ok {
+				days, haveDay = (int(d)-int(now.Weekday())+7)%7, true
+			} else if pt, ok := parts[w]; ok {
+				p = &pt
+			}
+		}
+	}
+	if m := clockTime.FindStringSubmatch(s); m != nil && (m[1] != "" || m[3] != "" || m[4] != "") {
+		h, _ := strconv.Atoi(m[2])
+		min := 0
+		if m[3] != "" {
+			min, _ = strconv.Atoi(m[3])
+		}
+		if m[4] == "pm" || (m[4] != "am" && p != nil && p.pm && h < 12) {
+			h += 12
+		}
+		if h > 23 || min > 59 {
+			return Range{}, fmt.Errorf("can't understand %q as a time", raw)
+		}
+		if !haveDay {
+			t := r.timeOfDay(h, min, 0, now)
+			return Range{t, t}, nil
+		}
+		t := time.Date(now.Year(), now.Month(), now.Day()+days, h, min, 0, 0, r.Location)
+		return Range{t, t}, nil
+	}
+	if p != nil {
+		at := func(days, hour int) time.Time {
+			return time.Date(now.Year(), now.Month(), now.Day()+days, hour, 0, 0, 0, r.Location)
+		}
+		if !haveDay && !at(0, p.end).After(now) {
+			// "in the morning" in the afternoon is tomorrow's.
+			days = 1
+		}
+		return Range{at(days, p.start), at(days, p.end)}, nil
+	}
+	if haveDay {
+		return r.day(now.AddDate(0, 0, days), now), nil
+	}
+	return Range{}, fmt.Errorf("can't understand %q as a time", raw)
+}
+
+func duration(n, unit string) time.Duration {
+	count := 1.0
+	switch n {
+	case "half an", "einer halben":
+		count = 0.5
+	case "a", "an", "one", "einer", "einem", "eine":
+	default:
+		i, _ := strconv.Atoi(n)
+		count = float64(i)
+	}
+	d := time.Minute
+	if strings.HasPrefix(unit, "h") || strings.HasPrefix(unit, "stunde") {
+		d = time.Hour
+	}
+	return time.Duration(count * float64(d))
+}
@@ -0,0 +1,218 @@
+// Package when resolves the dates and times people ask about: Dialogflow
+// @sys.date-time values (dates, times, date-times and periods) and relative
+// expressions like "in 20 minutes" or "tomorrow morning", in English or
+// German.
+//
+// Times are resolved in a Resolver's timezone. Dialogflow's v1 API formats
+// local times as if they were UTC ("2006-01-02T15:04:05Z"), so the "Z" is
+// ignored; explicit offsets like "+01:00" are honored.
+package when
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Value is a Dialogflow date-time parameter. It unmarshals from a string,
+// or from an object with "date_time", "startDateTime"/"endDateTime",
+// "startDate"/"endDate" or "startTime"/"endTime", which becomes a period
+// like "start/end".
+type Value string
+
+func (v *Value) UnmarshalJSON(bs []byte) error {
+	var s string
+	if err := json.Unmarshal(bs, &s); err == nil {
+		*v = Value(s)
+		return nil
+	}
+	var o map[string]string
+	if err := json.Unmarshal(bs, &o); err != nil {
+		return fmt.Errorf("date-time must be a string or an object: %v", err)
+	}
+	if dt := o["date_time"]; dt != "" {
+		*v = Value(dt)
+		return nil
+	}
+	for _, k := range []string{"DateTime", "Date", "Time"} {
+		if start, end := o["start"+k], o["end"+k]; start != "" || end != "" {
+			*v = Value(start + "/" + end)
+			return nil
+		}
+	}
+	*v = ""
+	return nil
+}
+
+// A Range is a resolved time: an instant if Start and End are equal, or a
+// period. The zero Range means no time was given, i.e. now.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (r Range) IsZero() bool {
+	return r.Start.IsZero()
+}
+
+// From returns when to look for departures from: Start, or now if the period
+// has already started.
+func (r Range) From(now time.Time) time.Time {
+	if r.End.After(r.Start) && r.Start.Before(now) && r.End.After(now) {
+		return now
+	}
+	return r.Start
+}
+
+// DefaultGrace is how long ago a time of day may be and still mean today.
+const DefaultGrace = 1 * time.Hour
+
+type Resolver struct {
+	Location *time.Location
+	// Now defaults to time.Now.
+	Now func() time.Time
+	// Grace is how long ago a time of day may be before it's taken to mean
+	// tomorrow, e.g. "9:00" at 14:00. Defaults to DefaultGrace.
+	Grace time.Duration
+}
+
+func (r Resolver) now() time.Time {
+	if r.Now != nil {
+		return r.Now().In(r.Location)
+	}
+	return time.Now().In(r.Location)
+}
+
+func (r Resolver) grace() time.Duration {
+	if r.Grace > 0 {
+		return r.Grace
+	}
+	return DefaultGrace
+}
+
+// Resolve resolves raw, which is a Dialogflow date-time value or a relative
+// expression. "" resolves to the zero Range.
+func (r Resolver) Resolve(raw string) (Range, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Range{}, nil
+	}
+	now := r.now()
+	if parts := strings.Split(raw, "/"); len(parts) == 2 {
+		return r.period(parts[0], parts[1], now)
+	}
+	if t, kind, ok := r.point(raw, now); ok {
+		if kind == date {
+			return r.day(t, now), nil
+		}
+		return Range{t, t}, nil
+	}
+	return r.relative(raw, now)
+}
+
+type kind int
+
+const (
+	instant kind = iota
+	date
+	clock
+)
+
+// Layouts of the points we understand, in the order tried.
+var layouts = []struct {
+	layout string
+	kind   kind
+	// local is whether times are in the Resolver's timezone, rather than
+	// carrying their own offset.
+	local bool
+}{
+	{"2006-01-02T15:04:05Z", instant, true},
+	{time.RFC3339, instant, false},
+	{"2006-01-02T15:04:05", instant, true},
+	{"2006-01-02 15:04", instant, true},
+	{"2006-01-02", date, true},
+	{"15:04:05", clock, true},
+	{"15:04", clock, true},
+}
+
+// point parses a single Dialogflow date, time or date-time.
+func (r Resolver) point(raw string, now time.Time) (time.Time, kind, bool) {
+	for _, l := range layouts {
+		var t time.Time
+		var err error
+		if l.local {
+			t, err = time.ParseInLocation(l.layout, raw, r.Location)
+		} else {
+			t, err = time.Parse(l.layout, raw)
+		}
+		if err != nil {
+			continue
+		}
+		if l.kind == clock {
+			return r.timeOfDay(t.Hour(), t.Minute(), t.Second(), now), clock, true
+		}
+		return t.In(r.Location), l.kind, true
+	}
+	return time.Time{}, 0, false
+}
+
+// timeOfDay returns the next time it's h:m:s, allowing for r's grace: at
+// 23:30, "00:15" is tomorrow, but at 12:00, "11:30" is still today.
+func (r Resolver) timeOfDay(h, m, s int, now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), h, m, s, 0, r.Location)
+	if t.Before(now.Add(-r.grace())) {
+		t = time.Date(now.Year(), now.Month(), now.Day()+1, h, m, s, 0, r.Location)
+	}
+	return t
+}
+
+// day returns the range for a whole day: from now if it's today, or from
+// the start of the day otherwise.
+func (r Resolver) day(t, now time.Time) Range {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, r.Location)
+	end := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, r.Location).Add(-time.Second)
+	if !start.After(now) && end.After(now) {
+		start = now
+	}
+	return Range{start, end}
+}
+
+func (r Resolver) period(a, b string, now time.Time) (Range, error) {
+	start, skind, ok := r.point(a, now)
+	if !ok {
+		return Range{}, fmt.Errorf("can't understand %q as a time", a)
+	}
+	end, ekind, ok := r.point(b, now)
+	if !ok {
+		return Range{}, fmt.Errorf("can't understand %q as a time", b)
+	}
+	if ekind == date {
+		end = r.day(end, now).End
+	}
+	if skind == clock && ekind == clock {
+		// Both were rolled separately, so start again from today.
+		at := func(t time.Time, days int) time.Time {
+			return time.Date(now.Year(), now.Month(), now.Day()+days, t.Hour(), t.Minute(), t.Second(), 0, r.Location)
+		}
+		days := 0
+		if at(end, 0).Before(at(start, 0)) {
+			// E.g. 22:00-02:00 ends the next day, unless we're in
+			// the part after midnight.
+			if now.Before(at(end, 0)) {
+				days = -1
+			}
+			start, end = at(start, days), at(end, days+1)
+		} else {
+			start, end = at(start, 0), at(end, 0)
+		}
+		if end.Before(now.Add(-r.grace())) {
+			// The whole period is over, so it's tomorrow's.
+			start, end = start.AddDate(0, 0, 1), end.AddDate(0, 0, 1)
+		}
+	}
+	if end.Before(start) {
+		return Range{}, fmt.Errorf("period %s/%s ends before it starts", a, b)
+	}
+	return Range{start, end}, nil
+}
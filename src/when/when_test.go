@@ -0,0 +1,148 @@
+package when
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var zurich, _ = time.LoadLocation("Europe/Zurich")
+
+func at(month time.Month, day, hour, min int) time.Time {
+	return time.Date(2018, month, day, hour, min, 0, 0, zurich)
+}
+
+func TestValueUnmarshal(t *testing.T) {
+	for _, tc := range []struct {
+		json string
+		want Value
+	}{
+		{`"2018-03-07T08:00:00Z"`, "2018-03-07T08:00:00Z"},
+		{`{"date_time": "2018-03-07T08:00:00Z"}`, "2018-03-07T08:00:00Z"},
+		{`{"startDateTime": "2018-03-07T08:00:00Z", "endDateTime": "2018-03-07T12:00:00Z"}`, "2018-03-07T08:00:00Z/2018-03-07T12:00:00Z"},
+		{`{"startTime": "08:00:00", "endTime": "12:00:00"}`, "08:00:00/12:00:00"},
+		{`{}`, ""},
+	} {
+		var v Value
+		if err := json.Unmarshal([]byte(tc.json), &v); err != nil {
+			t.Errorf("%s: want nil, got '%v'", tc.json, err)
+		} else if v != tc.want {
+			t.Errorf("%s: want %q, got %q", tc.json, tc.want, v)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	// Monday 5 March 2018.
+	monday := at(time.March, 5, 12, 0)
+	for _, tc := range []struct {
+		raw        string
+		now        time.Time
+		start, end time.Time
+	}{
+		{"2018-03-07T08:00:00Z", monday, at(time.March, 7, 8, 0), at(time.March, 7, 8, 0)},
+		{"2018-03-07T08:00:00+02:00", monday, at(time.March, 7, 7, 0), at(time.March, 7, 7, 0)},
+		{"18:30:00", monday, at(time.March, 5, 18, 30), at(time.March, 5, 18, 30)},
+		{"11:30:00", monday, at(time.March, 5, 11, 30), at(time.March, 5, 11, 30)},
+		{"09:00:00", monday, at(time.March, 6, 9, 0), at(time.March, 6, 9, 0)},
+		{"2018-03-05", monday, monday, at(time.March, 5, 23, 59).Add(59 * time.Second)},
+		{"2018-03-06", monday, at(time.March, 6, 0, 0), at(time.March, 6, 23, 59).Add(59 * time.Second)},
+		{"2018-03-07T08:00:00Z/2018-03-07T12:00:00Z", monday, at(time.March, 7, 8, 0), at(time.March, 7, 12, 0)},
+		{"13:00:00/15:00:00", monday, at(time.March, 5, 13, 0), at(time.March, 5, 15, 0)},
+		{"07:00:00/09:00:00", monday, at(time.March, 6, 7, 0), at(time.March, 6, 9, 0)},
+		{"22:00:00/02:00:00", monday, at(time.March, 5, 22, 0), at(time.March, 6, 2, 0)},
+		{"22:00:00/02:00:00", at(time.March, 6, 1, 0), at(time.March, 5, 22, 0), at(time.March, 6, 2, 0)},
+		// Around midnight.
+		{"00:15:00", at(time.March, 5, 23, 30), at(time.March, 6, 0, 15), at(time.March, 6, 0, 15)},
+		{"23:45:00", at(time.March, 6, 0, 30), at(time.March, 6, 23, 45), at(time.March, 6, 23, 45)},
+		// Relative.
+		{"now", monday, monday, monday},
+		{"in 20 minutes", monday, at(time.March, 5, 12, 20), at(time.March, 5, 12, 20)},
+		{"in einer halben Stunde", monday, at(time.March, 5, 12, 30), at(time.March, 5, 12, 30)},
+		{"in 2 hours", monday, at(time.March, 5, 14, 0), at(time.March, 5, 14, 0)},
+		{"tomorrow morning", monday, at(time.March, 6, 5, 0), at(time.March, 6, 12, 0)},
+		{"morgen früh", monday, at(time.March, 6, 5, 0), at(time.March, 6, 12, 0)},
+		{"heute Morgen", at(time.March, 5, 7, 0), at(time.March, 5, 5, 0), at(time.March, 5, 12, 0)},
+		{"in the morning", monday, at(time.March, 6, 5, 0), at(time.March, 6, 12, 0)},
+		{"tonight", monday, at(time.March, 5, 18, 0), at(time.March, 5, 23, 0)},
+		{"übermorgen", monday, at(time.March, 7, 0, 0), at(time.March, 7, 23, 59).Add(59 * time.Second)},
+		{"day after tomorrow at 8", monday, at(time.March, 7, 8, 0), at(time.March, 7, 8, 0)},
+		{"on Saturday at 7pm", monday, at(time.March, 10, 19, 0), at(time.March, 10, 19, 0)},
+		{"Samstag abends um 7", monday, at(time.March, 10, 19, 0), at(time.March, 10, 19, 0)},
+		{"morgen um 7.30", monday, at(time.March, 6, 7, 30), at(time.March, 6, 7, 30)},
+		{"um 19 Uhr", monday, at(time.March, 5, 19, 0), at(time.March, 5, 19, 0)},
+		{"at 8", monday, at(time.March, 6, 8, 0), at(time.March, 6, 8, 0)},
+	} {
+		r := Resolver{Location: zurich, Now: func() time.Time { return tc.now }}
+		got, err := r.Resolve(tc.raw)
+		if err != nil {
+			t.Errorf("%q at %v: want nil, got '%v'", tc.raw, tc.now, err)
+			continue
+		}
+		if !got.Start.Equal(tc.start) || !got.End.Equal(tc.end) {
+			t.Errorf("%q at %v: want %v-%v, got %v-%v", tc.raw, tc.now, tc.start, tc.end, got.Start, got.End)
+		}
+	}
+}
+
+func TestResolveDST(t *testing.T) {
+	// Clocks went forward from 02:00 to 03:00 on 25 March 2018.
+	for _, tc := range []struct {
+		raw  string
+		now  time.Time
+		want time.Time
+	}{
+		{"in 60 minutes", at(time.March, 25, 1, 30), at(time.March, 25, 3, 30)},
+		{"tomorrow at 8", at(time.March, 24, 20, 0), at(time.March, 25, 8, 0)},
+		{"08:00:00", at(time.March, 24, 20, 0), at(time.March, 25, 8, 0)},
+		{"2018-03-25T08:00:00Z", at(time.March, 24, 20, 0), at(time.March, 25, 8, 0)},
+		// And back on 28 October, so two hours after 01:00 CEST is the
+		// second 02:00.
+		{"in 2 hours", at(time.October, 28, 1, 0), time.Date(2018, time.October, 28, 1, 0, 0, 0, time.UTC)},
+		{"morgen um 7", at(time.October, 27, 18, 0), at(time.October, 28, 7, 0)},
+	} {
+		r := Resolver{Location: zurich, Now: func() time.Time { return tc.now }}
+		got, err := r.Resolve(tc.raw)
+		if err != nil {
+			t.Errorf("%q at %v: want nil, got '%v'", tc.raw, tc.now, err)
+		} else if !got.Start.Equal(tc.want) {
+			t.Errorf("%q at %v: want %v, got %v", tc.raw, tc.now, tc.want, got.Start)
+		}
+	}
+	if d := at(time.March, 26, 0, 0).Sub(at(time.March, 25, 0, 0)); d != 23*time.Hour {
+		t.Fatalf("want a 23 hour day, got %v", d)
+	}
+	r := Resolver{Location: zurich, Now: func() time.Time { return at(time.March, 24, 12, 0) }}
+	got, err := r.Resolve("2018-03-25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := got.End.Sub(got.Start); d != 23*time.Hour-time.Second {
+		t.Errorf("want the short day, got %v", d)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	r := Resolver{Location: zurich}
+	for _, raw := range []string{"whenever", "at 25", "2018-03-07T12:00:00Z/2018-03-07T08:00:00Z"} {
+		if _, err := r.Resolve(raw); err == nil {
+			t.Errorf("%q: want error, got nil", raw)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	now := at(time.March, 5, 12, 0)
+	for _, tc := range []struct {
+		r    Range
+		want time.Time
+	}{
+		{Range{at(time.March, 5, 8, 0), at(time.March, 5, 13, 0)}, now},
+		{Range{at(time.March, 5, 13, 0), at(time.March, 5, 15, 0)}, at(time.March, 5, 13, 0)},
+		{Range{at(time.March, 5, 8, 0), at(time.March, 5, 8, 0)}, at(time.March, 5, 8, 0)},
+	} {
+		if got := tc.r.From(now); !got.Equal(tc.want) {
+			t.Errorf("%v: want %v, got %v", tc.r, tc.want, got)
+		}
+	}
+}